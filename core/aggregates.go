@@ -0,0 +1,163 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"gopkg.in/Knetic/govaluate.v2"
+)
+
+// aggregation is an expression evaluated once for the whole query result, e.g.
+// 'count() >= 3 && max(Seconds_Behind_Master) < 30'. Fields are columns of the values of all rows and
+// can be used in the aggregate functions, additionally to the eval functions:
+//  count()         number of rows
+//  count(field)    number of values, which are not nil
+//  sum(field)      sum of the values
+//  min(field)      minimum of the values
+//  max(field)      maximum of the values
+//  avg(field)      average of the values
+//  distinct(field) number of distinct values
+type aggregation struct {
+	expr string
+}
+
+func compileAggr(aggrExpr string) (ret *aggregation, err error) {
+	if len(aggrExpr) > 0 {
+		if _, err = govaluate.NewEvaluableExpressionWithFunctions(aggrExpr, aggregateFunctions(nil)); err == nil {
+			ret = &aggregation{expr: aggrExpr}
+		} else {
+			Log.Err("The compilation of aggregate expression '%v' failed because of '%v'", aggrExpr, err)
+		}
+	}
+	return
+}
+
+func (o *aggregation) validate(items QueryResults, info string) (err error) {
+	var eval *govaluate.EvaluableExpression
+	if eval, err = govaluate.NewEvaluableExpressionWithFunctions(o.expr, aggregateFunctions(items)); err != nil {
+		return
+	}
+
+	var result interface{}
+	if result, err = eval.Eval(columns(items)); err != nil {
+		err = errors.New(fmt.Sprintf("Aggregation '%v' failed for %v because of %v", o.expr, info, err))
+	} else if valid, ok := result.(bool); !ok || !valid {
+		err = errors.New(fmt.Sprintf("Aggregation '%v' is not valid for %v", o.expr, info))
+	}
+	return
+}
+
+//columns provides the values of a field of all rows
+type columns QueryResults
+
+func (o columns) Get(name string) (ret interface{}, err error) {
+	values := make([]interface{}, len(o))
+	for i, item := range o {
+		if values[i], err = item.Get(name); err != nil {
+			return
+		}
+	}
+	ret = values
+	return
+}
+
+//aggregateFunctions are bound to the items, because of count(); govaluate spreads the columns to the arguments
+func aggregateFunctions(items QueryResults) (ret map[string]govaluate.ExpressionFunction) {
+	ret = make(map[string]govaluate.ExpressionFunction, len(evalFunctions)+6)
+	for name, function := range evalFunctions {
+		ret[name] = function
+	}
+
+	ret["count"] = func(args ...interface{}) (interface{}, error) {
+		if len(args) == 0 {
+			return float64(len(items)), nil
+		}
+		count := 0
+		for _, arg := range args {
+			if arg != nil {
+				count++
+			}
+		}
+		return float64(count), nil
+	}
+
+	ret["distinct"] = func(args ...interface{}) (interface{}, error) {
+		values := make(map[string]bool)
+		for _, arg := range args {
+			if arg != nil {
+				values[toText(arg)] = true
+			}
+		}
+		return float64(len(values)), nil
+	}
+
+	ret["sum"] = func(args ...interface{}) (ret interface{}, err error) {
+		var numbers []float64
+		if numbers, err = toNumbers("sum", args); err == nil {
+			sum := 0.0
+			for _, number := range numbers {
+				sum += number
+			}
+			ret = sum
+		}
+		return
+	}
+
+	ret["avg"] = func(args ...interface{}) (ret interface{}, err error) {
+		var numbers []float64
+		if numbers, err = toNumbers("avg", args); err == nil && len(numbers) > 0 {
+			sum := 0.0
+			for _, number := range numbers {
+				sum += number
+			}
+			ret = sum / float64(len(numbers))
+		} else if err == nil {
+			err = errors.New("avg of no values")
+		}
+		return
+	}
+
+	ret["min"] = func(args ...interface{}) (interface{}, error) {
+		return extreme("min", args, func(a, b float64) bool { return a < b })
+	}
+
+	ret["max"] = func(args ...interface{}) (interface{}, error) {
+		return extreme("max", args, func(a, b float64) bool { return a > b })
+	}
+	return
+}
+
+func extreme(function string, args []interface{}, better func(a, b float64) bool) (ret interface{}, err error) {
+	var numbers []float64
+	if numbers, err = toNumbers(function, args); err != nil {
+		return
+	}
+	if len(numbers) == 0 {
+		err = errors.New(fmt.Sprintf("%v of no values", function))
+		return
+	}
+	value := numbers[0]
+	for _, number := range numbers[1:] {
+		if better(number, value) {
+			value = number
+		}
+	}
+	ret = value
+	return
+}
+
+//toNumbers converts the values, which are not nil
+func toNumbers(function string, args []interface{}) (ret []float64, err error) {
+	ret = make([]float64, 0, len(args))
+	for _, arg := range args {
+		if arg == nil {
+			continue
+		}
+		var number float64
+		if number, err = toFloat(arg); err != nil {
+			err = errors.New(fmt.Sprintf("%v: %v", function, err))
+			return
+		}
+		ret = append(ret, number)
+	}
+	return
+}
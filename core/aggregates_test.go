@@ -0,0 +1,47 @@
+package core
+
+import (
+	"testing"
+)
+
+func TestAggregation(t *testing.T) {
+	items := QueryResults{
+		&MapQueryResult{map[string]interface{}{"Host": "db1", "Seconds_Behind_Master": int64(2)}},
+		&MapQueryResult{map[string]interface{}{"Host": "db2", "Seconds_Behind_Master": "12"}},
+		&MapQueryResult{map[string]interface{}{"Host": "db2", "Seconds_Behind_Master": nil}},
+	}
+
+	for expr, valid := range map[string]bool{
+		`count() >= 3 && max(Seconds_Behind_Master) < 30`: true,
+		`count(Seconds_Behind_Master) == 2`:               true,
+		`sum(Seconds_Behind_Master) == 14`:                true,
+		`min(Seconds_Behind_Master) == 2`:                 true,
+		`avg(Seconds_Behind_Master) == 7`:                 true,
+		`distinct(Host) == 2`:                             true,
+		`abs(min(Seconds_Behind_Master) - 12) == 10`:      true,
+		`max(Seconds_Behind_Master) < 10`:                 false,
+		`count() > 3`:                                     false,
+	} {
+		aggr, err := compileAggr(expr)
+		AssertEqual(t, err, nil, ErrorMessageBuilder)
+		AssertEqual(t, validateData(items, nil, true, aggr, "test") == nil, valid,
+			func(actual interface{}, expected interface{}) string {
+				return expr
+			})
+	}
+}
+
+func TestAggregationEmptyAndCompare(t *testing.T) {
+	aggr, _ := compileAggr("count() == 0")
+	AssertEqual(t, validateData(QueryResults{}, nil, true, aggr, "test"), nil, ErrorMessageBuilder)
+
+	composed, err := ComposeQueryResults("_", []QueryResults{
+		{&MapQueryResult{map[string]interface{}{"rows": 100}}, &MapQueryResult{map[string]interface{}{"rows": 5}}},
+		{&MapQueryResult{map[string]interface{}{"rows": 101}}, &MapQueryResult{map[string]interface{}{"rows": 5}}},
+	})
+	AssertEqual(t, err, nil, ErrorMessageBuilder)
+
+	aggr, _ = compileAggr("sum(rows_1) == 105 && sum(rows_2) == 106")
+	eval, _ := compileEval("rows_2 >= rows_1")
+	AssertEqual(t, validateData(composed, eval, true, aggr, "test"), nil, ErrorMessageBuilder)
+}
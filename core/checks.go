@@ -89,6 +89,21 @@ func (o *Eye) buildCompareCheck(checkKey string, serviceNames []string, onlyRunn
 	if eval, err = compileEval(req.EvalExpr); err != nil {
 		return
 	}
+
+	var aggr *aggregation
+	if aggr, err = compileAggr(req.AggrExpr); err != nil {
+		return
+	}
+
+	joinKeys, equalFields := req.JoinKeys, req.EqualFields
+	if len(joinKeys) == 0 && len(equalFields) == 0 {
+		joinKeys, equalFields = compareDefaults(req.Kind)
+	}
+
+	var tolerances map[string]*tolerance
+	if tolerances, err = compileTolerances(req.Tolerances); err != nil {
+		return
+	}
 	queries := make([]Query, len(serviceNames))
 
 	var serviceQuery Check
@@ -101,7 +116,9 @@ func (o *Eye) buildCompareCheck(checkKey string, serviceNames []string, onlyRunn
 	}
 
 	if err == nil {
-		ret = &MultiCheck{info: checkKey, queries: queries, eval: eval, onlyRunning: onlyRunning}
+		ret = &MultiCheck{info: checkKey, queries: queries, eval: eval, aggr: aggr, onlyRunning: onlyRunning,
+			joinKeys: joinKeys, equalFields: equalFields, tolerances: tolerances,
+			services: serviceNames}
 	}
 	return
 }
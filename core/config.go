@@ -63,6 +63,9 @@ type FieldsExporter struct {
 	Fields    []string
 	Separator string
 	Services  []string
+	Params    []*Param
+	Listing   *FileListing
+	Target    *ExportTarget
 }
 
 type FileExporter struct {
@@ -72,6 +75,9 @@ type FileExporter struct {
 	Fields         []string
 	SourceFileExpr string
 	Services       []string
+	Params         []*Param
+	Listing        *FileListing
+	Target         *ExportTarget
 }
 
 type SimpleExecutor struct {
@@ -122,5 +128,36 @@ func (o *Config) ExtractAccessKeys() (ret []string) {
 	for i, item := range o.Http {
 		ret[pre+i] = item.AccessKey
 	}
+	for _, item := range o.MySql {
+		ret = append(ret, item.Tls.accessKeys()...)
+	}
+	for _, item := range o.Http {
+		ret = append(ret, item.Tls.accessKeys()...)
+	}
+	for _, item := range o.Elastic {
+		ret = appendAccessKey(ret, item.AccessKey)
+		ret = appendAccessKey(ret, item.ApiKeyAccessKey)
+		ret = append(ret, item.Tls.accessKeys()...)
+	}
+	for _, item := range o.FieldsExporter {
+		ret = appendTargetAccessKey(ret, item.Target)
+	}
+	for _, item := range o.FileExporter {
+		ret = appendTargetAccessKey(ret, item.Target)
+	}
 	return
 }
+
+func appendTargetAccessKey(accessKeys []string, target *ExportTarget) []string {
+	if target != nil {
+		return appendAccessKey(accessKeys, target.AccessKey)
+	}
+	return accessKeys
+}
+
+func appendAccessKey(accessKeys []string, accessKey string) []string {
+	if len(accessKey) > 0 {
+		return append(accessKeys, accessKey)
+	}
+	return accessKeys
+}
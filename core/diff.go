@@ -0,0 +1,258 @@
+package core
+
+import (
+	"encoding/csv"
+	"fmt"
+	"html/template"
+	"io"
+	"sort"
+	"strings"
+)
+
+const (
+	DiffFormatJson = "json"
+	DiffFormatCsv  = "csv"
+	DiffFormatHtml = "html"
+
+	//key of the row position, if the rows of the services are not joined by key fields
+	DiffRowKey = "Row"
+)
+
+// DiffReport lists per row (join key or position) the services, which disagree on fields, with their values side by side.
+type DiffReport struct {
+	Check    string
+	Services []string
+	Keys     []string
+	Rows     []*DiffRow
+}
+
+type DiffRow struct {
+	Key map[string]interface{}
+	//services without a row for the key
+	Missing []string
+	Fields  []*FieldDiff
+}
+
+type FieldDiff struct {
+	Field string
+	//values in the order of the services, nil for missing rows
+	Values []interface{}
+}
+
+// DiffError is returned by compare checks, if the services have different values, it carries the structured diff.
+type DiffError struct {
+	Report *DiffReport
+}
+
+func (o *DiffError) Error() string {
+	return fmt.Sprintf("Validation of %v failed, %v", o.Report.Check, o.Report.Summary(5))
+}
+
+func (o *DiffReport) Equal() bool {
+	return len(o.Rows) == 0
+}
+
+// Summary describes the first maxRows differences in a readable form
+func (o *DiffReport) Summary(maxRows int) string {
+	if o.Equal() {
+		return "no differences"
+	}
+	parts := make([]string, 0, maxRows+1)
+	for i, row := range o.Rows {
+		if i == maxRows {
+			parts = append(parts, fmt.Sprintf("and %v more", len(o.Rows)-maxRows))
+			break
+		}
+		var items []string
+		if len(row.Missing) > 0 {
+			items = append(items, fmt.Sprintf("missing in %v", strings.Join(row.Missing, ", ")))
+		}
+		for _, field := range row.Fields {
+			values := make([]string, len(field.Values))
+			for y, value := range field.Values {
+				values[y] = fmt.Sprintf("%v=%v", o.Services[y], toText(value))
+			}
+			items = append(items, fmt.Sprintf("'%v' differs (%v)", field.Field, strings.Join(values, ", ")))
+		}
+		parts = append(parts, fmt.Sprintf("%v: %v", o.keyText(row), strings.Join(items, "; ")))
+	}
+	return fmt.Sprintf("%v rows differ: %v", len(o.Rows), strings.Join(parts, " | "))
+}
+
+func (o *DiffReport) keyText(row *DiffRow) string {
+	values := make([]string, len(o.Keys))
+	for i, key := range o.Keys {
+		values[i] = fmt.Sprintf("%v=%v", key, toText(row.Key[key]))
+	}
+	return strings.Join(values, ",")
+}
+
+// WriteCsv writes a line per differing field and a 'Missing' line per row, which is missing in services
+func (o *DiffReport) WriteCsv(out io.Writer) (err error) {
+	writer := csv.NewWriter(out)
+	header := append(append([]string{}, o.Keys...), "Field")
+	if err = writer.Write(append(header, o.Services...)); err != nil {
+		return
+	}
+	for _, row := range o.Rows {
+		for _, field := range o.rowFields(row) {
+			line := make([]string, 0, len(header)+len(o.Services))
+			for _, key := range o.Keys {
+				line = append(line, toText(row.Key[key]))
+			}
+			line = append(line, field.Field)
+			for _, value := range field.Values {
+				line = append(line, toText(value))
+			}
+			if err = writer.Write(line); err != nil {
+				return
+			}
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+func (o *DiffReport) WriteHtml(out io.Writer) error {
+	return diffHtml.Execute(out, o)
+}
+
+//rowFields returns the field diffs of the row, the missing services as field 'Missing' with a flag per service
+func (o *DiffReport) rowFields(row *DiffRow) (ret []*FieldDiff) {
+	if len(row.Missing) > 0 {
+		missing := &FieldDiff{Field: MissingField, Values: make([]interface{}, len(o.Services))}
+		for i, service := range o.Services {
+			missing.Values[i] = contains(row.Missing, service)
+		}
+		ret = append(ret, missing)
+	}
+	return append(ret, row.Fields...)
+}
+
+var diffHtml = template.Must(template.New("diff").Funcs(template.FuncMap{"text": toText}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="UTF-8">
+<title>Diff of {{.Check}}</title>
+<style>
+body { font-family: sans-serif; }
+table { border-collapse: collapse; }
+th, td { border: 1px solid #ccc; padding: 4px 8px; text-align: left; }
+th { background: #eee; }
+td.missing { background: #fdd; }
+</style>
+</head>
+<body>
+<h1>Diff of {{.Check}}</h1>
+{{if .Equal}}<p>No differences</p>{{else}}<p>{{len .Rows}} rows differ</p>
+<table>
+<tr>{{range .Keys}}<th>{{.}}</th>{{end}}<th>Field</th>{{range .Services}}<th>{{.}}</th>{{end}}</tr>
+{{$report := .}}{{range .Rows}}{{$row := .}}{{range $report.RowFields .}}<tr>{{range $report.Keys}}<td>{{text (index $row.Key .)}}</td>{{end}}<td>{{.Field}}</td>{{$field := .Field}}{{range .Values}}<td{{if eq $field "Missing"}}{{if .}} class="missing"{{end}}{{end}}>{{text .}}</td>{{end}}</tr>
+{{end}}{{end}}</table>{{end}}
+</body>
+</html>
+`))
+
+//RowFields is used by the html template
+func (o *DiffReport) RowFields(row *DiffRow) []*FieldDiff {
+	return o.rowFields(row)
+}
+
+//buildDiffReport compares the fields of the composite rows, if no fields are given all fields of the rows except the keys
+func buildDiffReport(check string, services []string, keys []string, fields []string,
+	tolerances map[string]*tolerance, data QueryResults) (ret *DiffReport, err error) {
+
+	ret = &DiffReport{Check: check, Services: services, Keys: keys, Rows: make([]*DiffRow, 0)}
+	if len(keys) == 0 {
+		ret.Keys = []string{DiffRowKey}
+	}
+	for i, item := range data {
+		composite := item.(*CompositeQueryResult)
+		row := &DiffRow{Key: composite.Keys}
+		if row.Key == nil {
+			row.Key = map[string]interface{}{DiffRowKey: i + 1}
+		}
+		for y, service := range services {
+			if y >= len(composite.Data) || composite.Data[y] == nil {
+				row.Missing = append(row.Missing, service)
+			}
+		}
+
+		rowFields := fields
+		if len(rowFields) == 0 {
+			rowFields = compositeFields(composite, keys)
+		}
+		for _, field := range rowFields {
+			var diff *FieldDiff
+			if diff, err = diffField(composite, field, len(services), toleranceOf(tolerances, field)); err != nil {
+				return
+			}
+			if diff != nil {
+				row.Fields = append(row.Fields, diff)
+			}
+		}
+		if len(row.Missing) > 0 || len(row.Fields) > 0 {
+			ret.Rows = append(ret.Rows, row)
+		}
+	}
+	return
+}
+
+//diffField returns the values of the field, if any two of the present rows differ beyond the tolerance
+func diffField(composite *CompositeQueryResult, field string, count int, tolerance *tolerance) (
+	ret *FieldDiff, err error) {
+
+	values := make([]interface{}, count)
+	var present []int
+	for i := 0; i < count && i < len(composite.Data); i++ {
+		row := composite.Data[i]
+		if row == nil {
+			continue
+		}
+		if values[i], err = row.Get(field); err != nil {
+			return
+		}
+		if b, ok := values[i].([]byte); ok {
+			values[i] = string(b)
+		}
+		present = append(present, i)
+	}
+	differs := false
+	for i := 0; i < len(present) && !differs; i++ {
+		for y := i + 1; y < len(present) && !differs; y++ {
+			differs = !tolerance.equal(values[present[i]], values[present[y]])
+		}
+	}
+	if differs {
+		ret = &FieldDiff{Field: field, Values: values}
+	}
+	return
+}
+
+//compositeFields returns the sorted field names of all rows without the keys
+func compositeFields(composite *CompositeQueryResult, keys []string) (ret []string) {
+	names := make(map[string]bool)
+	for _, row := range composite.Data {
+		if mapRow, ok := row.(*MapQueryResult); ok {
+			for name := range mapRow.Data {
+				if !contains(keys, name) {
+					names[name] = true
+				}
+			}
+		}
+	}
+	for name := range names {
+		ret = append(ret, name)
+	}
+	sort.Strings(ret)
+	return
+}
+
+func contains(items []string, item string) bool {
+	for _, current := range items {
+		if current == item {
+			return true
+		}
+	}
+	return false
+}
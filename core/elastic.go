@@ -1,6 +1,8 @@
 package core
 
 import (
+	"bytes"
+	"encoding/base64"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -9,18 +11,57 @@ import (
 	"gopkg.in/Knetic/govaluate.v2"
 	"gopkg.in/olivere/elastic.v5"
 	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"sort"
 	"strings"
 	"time"
 )
 
+const (
+	ElasticSearch = "search"
+	ElasticCount  = "count"
+	ElasticAggs   = "aggs"
+	ElasticCat    = "cat"
+	ElasticApi    = "api"
+
+	ElasticHealth  = "health"
+	ElasticIndices = "indices"
+	ElasticNodes   = "nodes"
+)
+
+//diagnostic APIs, which are allowed for the kinds cat and api
+var elasticApiPrefixes = []string{"/_cat", "/_cluster", "/_nodes"}
+
 type Elastic struct {
 	Name       string `default:"elastic"`
 	Host       string `default:"localhost"`
 	Port       int    `default:"9200"`
 	ScrollSize int    `default:"500"`
 
+	//node urls of the cluster, e.g. https://node1:9200, used instead of Host and Port
+	Urls []string
+
 	Index string
 
+	//basic auth with user and password of the access
+	AccessKey string
+	//API key auth, the access password is the encoded API key, or the user is the id and the password the API key
+	ApiKeyAccessKey string
+
+	//https is used, if set
+	Tls *Tls
+
+	//discover further nodes of the cluster, off by default, because the published node addresses
+	//are often not reachable from outside of the cluster
+	Sniff bool
+	//check the nodes periodically in the background
+	Healthcheck bool
+
+	//the ping fails on the cluster health status yellow, otherwise a warning is logged only
+	PingFailOnYellow bool
+
 	PingTimeoutMillis  int
 	QueryTimeoutMillis int
 }
@@ -41,10 +82,25 @@ func (o *ElasticService) Name() string {
 	return o.elastic.Name
 }
 
+func (o *Elastic) urls() []string {
+	if len(o.Urls) > 0 {
+		return o.Urls
+	}
+	scheme := "http"
+	if o.Tls != nil {
+		scheme = "https"
+	}
+	return []string{fmt.Sprintf("%v://%v:%d", scheme, o.Host, o.Port)}
+}
+
 func (o *ElasticService) Init() (err error) {
 	if o.client == nil {
-		url := fmt.Sprintf("http://%v:%d", o.elastic.Host, o.elastic.Port)
-		o.client, err = elastic.NewClient(elastic.SetURL(url))
+		urls := o.elastic.urls()
+		var options []elastic.ClientOptionFunc
+		if options, err = o.clientOptions(urls); err != nil {
+			return
+		}
+		o.client, err = elastic.NewClient(options...)
 		if err == nil {
 			o.clusterHealth = o.client.ClusterHealth().Index(o.elastic.Index)
 			o.context = context.Background()
@@ -62,13 +118,71 @@ func (o *ElasticService) Init() (err error) {
 			//connect
 			o.ping()
 		} else {
-			Log.Debug("Elastic client can't connect to %v because of %v", url, err)
+			Log.Debug("Elastic client can't connect to %v because of %v", urls, err)
 			o.client = nil
 		}
 	}
 	return
 }
 
+func (o *ElasticService) clientOptions(urls []string) (ret []elastic.ClientOptionFunc, err error) {
+	ret = []elastic.ClientOptionFunc{elastic.SetURL(urls...),
+		elastic.SetSniff(o.elastic.Sniff), elastic.SetHealthcheck(o.elastic.Healthcheck)}
+
+	if len(o.elastic.AccessKey) > 0 {
+		var access as.Access
+		if access, err = o.accessFinder.FindAccess(o.elastic.AccessKey); err != nil {
+			return
+		}
+		ret = append(ret, elastic.SetBasicAuth(access.User, access.Password))
+	}
+
+	transport := &http.Transport{Proxy: http.ProxyFromEnvironment}
+	if o.elastic.Tls != nil {
+		if transport.TLSClientConfig, err = o.elastic.Tls.Config(o.accessFinder); err != nil {
+			err = errors.New(fmt.Sprintf("Invalid TLS configuration of %v: %v", o.Name(), err))
+			return
+		}
+	}
+
+	var roundTripper http.RoundTripper = transport
+	if len(o.elastic.ApiKeyAccessKey) > 0 {
+		var access as.Access
+		if access, err = o.accessFinder.FindAccess(o.elastic.ApiKeyAccessKey); err != nil {
+			return
+		}
+		roundTripper = &apiKeyTransport{apiKey: encodeApiKey(access), transport: transport}
+	}
+	ret = append(ret, elastic.SetHttpClient(&http.Client{Transport: roundTripper}))
+	return
+}
+
+//encodeApiKey returns the password, if no user (API key id) is set, because it is already encoded then
+func encodeApiKey(access as.Access) string {
+	if len(access.User) == 0 {
+		return access.Password
+	}
+	return base64.StdEncoding.EncodeToString([]byte(access.User + ":" + access.Password))
+}
+
+//apiKeyTransport authorizes the requests with the API key
+type apiKeyTransport struct {
+	apiKey    string
+	transport http.RoundTripper
+}
+
+func (o *apiKeyTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	//the request must not be modified by a RoundTripper
+	authorized := new(http.Request)
+	*authorized = *req
+	authorized.Header = make(http.Header, len(req.Header)+1)
+	for key, values := range req.Header {
+		authorized.Header[key] = values
+	}
+	authorized.Header.Set("Authorization", "ApiKey "+o.apiKey)
+	return o.transport.RoundTrip(authorized)
+}
+
 func (o *ElasticService) Close() {
 	if o.client != nil {
 		o.client.Stop()
@@ -92,8 +206,19 @@ func (o *ElasticService) Ping() (err error) {
 func (o *ElasticService) ping() (err error) {
 	var res *elastic.ClusterHealthResponse
 	if res, err = o.clusterHealth.Do(o.context); err == nil {
-		if strings.EqualFold(res.Status, "RED") {
-			err = errors.New("Cluster health status is [RED]")
+		err = o.checkHealthStatus(res.Status)
+	}
+	return
+}
+
+func (o *ElasticService) checkHealthStatus(status string) (err error) {
+	if strings.EqualFold(status, "RED") {
+		err = errors.New("Cluster health status is [RED]")
+	} else if strings.EqualFold(status, "YELLOW") {
+		if o.elastic.PingFailOnYellow {
+			err = errors.New("Cluster health status is [YELLOW]")
+		} else {
+			Log.Info("Cluster health status of %v is [YELLOW]", o.Name())
 		}
 	}
 	return
@@ -109,7 +234,36 @@ func (o *ElasticService) NewСheck(req *ValidationRequest) (ret Check, err error
 		return
 	}
 
-	ret = &elasticCheck{info: req.CheckKey(o.Name()), query: req.Query, eval: eval, all: req.All, service: o}
+	var aggr *aggregation
+	if aggr, err = compileAggr(req.AggrExpr); err != nil {
+		return
+	}
+
+	kind := strings.ToLower(req.Kind)
+	switch kind {
+	case "":
+		kind = ElasticSearch
+	case ElasticApi:
+		if _, err = elasticApiUrl(req.Query); err != nil {
+			return
+		}
+	case ElasticSearch, ElasticCount, ElasticAggs, ElasticCat, ElasticHealth, ElasticIndices, ElasticNodes:
+	default:
+		err = errors.New(fmt.Sprintf("The kind '%v' is not supported by %v", req.Kind, o.Name()))
+		return
+	}
+
+	jsonPath := req.JsonPath
+	if len(jsonPath) == 0 {
+		jsonPath = "$"
+	}
+	var path *JsonPath
+	if path, err = compileJsonPath(jsonPath); err != nil {
+		return
+	}
+
+	ret = &elasticCheck{info: req.CheckKey(o.Name()), kind: kind, query: req.Query, jsonPath: path,
+		eval: eval, all: req.All, aggr: aggr, service: o}
 	return
 }
 
@@ -118,43 +272,187 @@ func (o *ElasticService) NewExporter(req *ExportRequest) (ret Exporter, err erro
 	return
 }
 
-//buildCheck
-type elasticCheck struct {
-	info    string
-	query   string
-	all     bool
-	eval    *govaluate.EvaluableExpression
-	service *ElasticService
-	search  *elastic.SearchService
+func (o *ElasticService) search(query string) (ret []map[string]interface{}, err error) {
+	var res *elastic.SearchResult
+	if res, err = o.client.Search(o.elastic.Index).Source(query).Do(o.context); err != nil {
+		return
+	}
+	for _, hit := range res.Hits.Hits {
+		item := make(map[string]interface{})
+		if err := json.Unmarshal(*hit.Source, &item); err == nil {
+			ret = append(ret, item)
+		} else {
+			Log.Info("Error %v, at unmarshal of %v", err, hit)
+		}
+	}
+	return
 }
 
-func (o elasticCheck) Info() string {
-	return o.info
+func (o *ElasticService) count(query string) (ret []map[string]interface{}, err error) {
+	count := o.client.Count(o.elastic.Index)
+	if len(query) > 0 {
+		count.BodyString(query)
+	}
+	var res int64
+	if res, err = count.Do(o.context); err == nil {
+		ret = []map[string]interface{}{{"count": res}}
+	}
+	return
+}
+
+func (o *ElasticService) aggs(query string) (ret []map[string]interface{}, err error) {
+	var res *elastic.SearchResult
+	if res, err = o.client.Search(o.elastic.Index).Source(query).Size(0).Do(o.context); err == nil {
+		ret, err = aggregationRows(res.Aggregations)
+	}
+	return
 }
 
-func (o elasticCheck) Validate() error {
-	return validate(o, o.eval, o.all)
+//api performs a GET request to the path, e.g. '/_cluster/pending_tasks?local=true', and maps the selection
+//of the json path to rows
+func (o *ElasticService) api(path string, format string, jsonPath *JsonPath) (ret []map[string]interface{}, err error) {
+	var apiUrl *url.URL
+	if apiUrl, err = elasticApiUrl(path); err != nil {
+		return
+	}
+	params := apiUrl.Query()
+	if len(format) > 0 {
+		params.Set("format", format)
+	}
+
+	var res *elastic.Response
+	if res, err = o.client.PerformRequest(o.context, http.MethodGet, apiUrl.Path, params, nil); err == nil {
+		ret, err = jsonPath.Rows(bytes.NewReader(res.Body))
+	}
+	return
 }
 
-func (o elasticCheck) Query() (data QueryResults, err error) {
-	if err = o.service.Init(); err == nil {
-		if o.search == nil {
-			o.search = o.service.client.Search(o.service.elastic.Index).Size(5).Source(o.query)
+//elasticApiUrl parses the path, only the diagnostic APIs are allowed, e.g. not '_search' or '_security'
+func elasticApiUrl(apiPath string) (ret *url.URL, err error) {
+	if ret, err = url.Parse(apiPath); err != nil {
+		return
+	}
+	ret.Path = path.Clean("/" + ret.Path)
+	for _, prefix := range elasticApiPrefixes {
+		if ret.Path == prefix || strings.HasPrefix(ret.Path, prefix+"/") {
+			return
 		}
-		//l.Debug(string(Data))
-		var res *elastic.SearchResult
-		if res, err = o.search.Do(o.service.context); err != nil {
+	}
+	err = errors.New(fmt.Sprintf("The path '%v' is not allowed, allowed are: %v", apiPath,
+		strings.Join(elasticApiPrefixes, ", ")))
+	return
+}
+
+//aggregationRows maps the buckets of every aggregation to rows, a metric aggregation to a single row.
+//Sub aggregations with a single value are mapped by their name, e.g. 'avg_latency', others are flattened.
+func aggregationRows(aggs elastic.Aggregations) (ret []map[string]interface{}, err error) {
+	names := make([]string, 0, len(aggs))
+	for name := range aggs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		var agg map[string]interface{}
+		if err = json.Unmarshal(*aggs[name], &agg); err != nil {
 			return
 		}
-		data := make([]QueryResult, 0)
-		for _, hit := range res.Hits.Hits {
-			item := make(map[string]interface{})
-			err := json.Unmarshal(*hit.Source, &item)
-			if err == nil {
-				data = append(data, &MapQueryResult{item})
+		switch buckets := agg["buckets"].(type) {
+		case []interface{}:
+			for _, bucket := range buckets {
+				if item, ok := bucket.(map[string]interface{}); ok {
+					ret = append(ret, bucketRow(name, item))
+				}
+			}
+		case map[string]interface{}:
+			//keyed buckets, e.g. of filters aggregations
+			keys := make([]string, 0, len(buckets))
+			for key := range buckets {
+				keys = append(keys, key)
+			}
+			sort.Strings(keys)
+			for _, key := range keys {
+				if item, ok := buckets[key].(map[string]interface{}); ok {
+					row := bucketRow(name, item)
+					row["key"] = key
+					ret = append(ret, row)
+				}
+			}
+		default:
+			ret = append(ret, bucketRow(name, agg))
+		}
+	}
+	return
+}
+
+func bucketRow(name string, bucket map[string]interface{}) (ret map[string]interface{}) {
+	ret = map[string]interface{}{"aggregation": name}
+	for key, value := range bucket {
+		if child, ok := value.(map[string]interface{}); ok {
+			if metric, ok := child["value"]; ok {
+				ret[key] = metric
 			} else {
-				Log.Info("Error %v, at unmarshal of %v", err, hit)
+				flattenJson(key+".", child, ret)
 			}
+		} else {
+			ret[key] = value
+		}
+	}
+	return
+}
+
+//buildCheck
+type elasticCheck struct {
+	info     string
+	kind     string
+	query    string
+	jsonPath *JsonPath
+	all      bool
+	eval     *govaluate.EvaluableExpression
+	aggr     *aggregation
+	service  *ElasticService
+}
+
+func (o *elasticCheck) Info() string {
+	return o.info
+}
+
+func (o *elasticCheck) Validate() error {
+	return validate(o, o.eval, o.all, o.aggr)
+}
+
+func (o *elasticCheck) Query() (data QueryResults, err error) {
+	if err = o.service.Init(); err != nil {
+		return
+	}
+
+	//time placeholders are evaluated for every run
+	query := replaceTimePlaceHolders(o.query, LayoutRfc3339, nil)
+
+	var rows []map[string]interface{}
+	switch o.kind {
+	case ElasticCount:
+		rows, err = o.service.count(query)
+	case ElasticAggs:
+		rows, err = o.service.aggs(query)
+	case ElasticCat:
+		rows, err = o.service.api("/_cat/"+strings.TrimPrefix(query, "/"), "json", o.jsonPath)
+	case ElasticApi:
+		rows, err = o.service.api(query, "", o.jsonPath)
+	case ElasticHealth:
+		rows, err = o.service.health()
+	case ElasticIndices:
+		rows, err = o.service.indices()
+	case ElasticNodes:
+		rows, err = o.service.nodes()
+	default:
+		rows, err = o.service.search(query)
+	}
+
+	if err == nil {
+		data = make([]QueryResult, len(rows))
+		for i, row := range rows {
+			data[i] = &MapQueryResult{row}
 		}
 		Log.Debug("elastic Data: %s", data)
 	}
@@ -184,11 +482,12 @@ func (o elasticExporter) Export(params map[string]string) (err error) {
 	if out, err = o.req.CreateOut(params); err != nil {
 		return
 	}
-	defer out.Close()
+	defer closeExportOut(out, &err)
 
 	var res *elastic.SearchResult
 
-	query := prepareQuery(o.req.Query, params)
+	//the values are placed in JSON strings, e.g. "@@DAY@@"
+	query := prepareQuery(o.req.Query, params, jsonEscape)
 
 	o.scroll.Body(query)
 
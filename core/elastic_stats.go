@@ -0,0 +1,166 @@
+package core
+
+import (
+	"encoding/json"
+	"gopkg.in/olivere/elastic.v5"
+	"net/http"
+	"sort"
+)
+
+type elasticIndicesStats struct {
+	Indices map[string]*struct {
+		Primaries elasticIndexStats `json:"primaries"`
+		Total     elasticIndexStats `json:"total"`
+	} `json:"indices"`
+}
+
+type elasticIndexStats struct {
+	Docs struct {
+		Count   int64 `json:"count"`
+		Deleted int64 `json:"deleted"`
+	} `json:"docs"`
+	Store struct {
+		SizeInBytes int64 `json:"size_in_bytes"`
+	} `json:"store"`
+}
+
+type elasticNodesStats struct {
+	Nodes map[string]*struct {
+		Name string `json:"name"`
+		Host string `json:"host"`
+		Jvm  struct {
+			Mem struct {
+				HeapUsedInBytes int64 `json:"heap_used_in_bytes"`
+				HeapUsedPercent int64 `json:"heap_used_percent"`
+				HeapMaxInBytes  int64 `json:"heap_max_in_bytes"`
+			} `json:"mem"`
+		} `json:"jvm"`
+		Fs struct {
+			Total struct {
+				TotalInBytes     int64 `json:"total_in_bytes"`
+				FreeInBytes      int64 `json:"free_in_bytes"`
+				AvailableInBytes int64 `json:"available_in_bytes"`
+			} `json:"total"`
+		} `json:"fs"`
+		Os struct {
+			Cpu struct {
+				Percent     int64              `json:"percent"`
+				LoadAverage map[string]float64 `json:"load_average"`
+			} `json:"cpu"`
+		} `json:"os"`
+	} `json:"nodes"`
+}
+
+//health returns the cluster health as a single row, e.g. status, number_of_nodes and unassigned_shards
+func (o *ElasticService) health() (ret []map[string]interface{}, err error) {
+	var res *elastic.ClusterHealthResponse
+	if res, err = o.clusterHealth.Do(o.context); err != nil {
+		return
+	}
+	var row map[string]interface{}
+	if row, err = toJsonMap(res); err == nil {
+		delete(row, "indices")
+		ret = []map[string]interface{}{row}
+	}
+	return
+}
+
+//indices returns a row per index with its health, shards, doc count and store size
+func (o *ElasticService) indices() (ret []map[string]interface{}, err error) {
+	var health *elastic.ClusterHealthResponse
+	if health, err = o.client.ClusterHealth().Index(o.elastic.Index).Level("indices").Do(o.context); err != nil {
+		return
+	}
+
+	path := "/_stats/docs,store"
+	if len(o.elastic.Index) > 0 {
+		path = "/" + o.elastic.Index + path
+	}
+	var res *elastic.Response
+	if res, err = o.client.PerformRequest(o.context, http.MethodGet, path, nil, nil); err != nil {
+		return
+	}
+	return indexRows(health, res.Body)
+}
+
+//nodes returns a row per node with its JVM heap, disk and CPU usage
+func (o *ElasticService) nodes() (ret []map[string]interface{}, err error) {
+	var res *elastic.Response
+	if res, err = o.client.PerformRequest(o.context, http.MethodGet, "/_nodes/stats/jvm,fs,os", nil, nil); err != nil {
+		return
+	}
+	return nodeRows(res.Body)
+}
+
+func indexRows(health *elastic.ClusterHealthResponse, statsData []byte) (ret []map[string]interface{}, err error) {
+	var stats elasticIndicesStats
+	if err = json.Unmarshal(statsData, &stats); err != nil {
+		return
+	}
+
+	names := make([]string, 0, len(health.Indices))
+	for name := range health.Indices {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		var row map[string]interface{}
+		if row, err = toJsonMap(health.Indices[name]); err != nil {
+			return
+		}
+		row["index"] = name
+		if item, ok := stats.Indices[name]; ok {
+			row["docs_count"] = item.Primaries.Docs.Count
+			row["docs_deleted"] = item.Primaries.Docs.Deleted
+			row["primaries_store_size_in_bytes"] = item.Primaries.Store.SizeInBytes
+			row["store_size_in_bytes"] = item.Total.Store.SizeInBytes
+		}
+		ret = append(ret, row)
+	}
+	return
+}
+
+func nodeRows(data []byte) (ret []map[string]interface{}, err error) {
+	var stats elasticNodesStats
+	if err = json.Unmarshal(data, &stats); err != nil {
+		return
+	}
+
+	ids := make([]string, 0, len(stats.Nodes))
+	for id := range stats.Nodes {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	for _, id := range ids {
+		node := stats.Nodes[id]
+		disk := node.Fs.Total
+		var diskUsedPercent float64
+		if disk.TotalInBytes > 0 {
+			diskUsedPercent = float64(disk.TotalInBytes-disk.AvailableInBytes) * 100 / float64(disk.TotalInBytes)
+		}
+		ret = append(ret, map[string]interface{}{
+			"node":                    id,
+			"name":                    node.Name,
+			"host":                    node.Host,
+			"heap_used_percent":       node.Jvm.Mem.HeapUsedPercent,
+			"heap_used_in_bytes":      node.Jvm.Mem.HeapUsedInBytes,
+			"heap_max_in_bytes":       node.Jvm.Mem.HeapMaxInBytes,
+			"disk_total_in_bytes":     disk.TotalInBytes,
+			"disk_available_in_bytes": disk.AvailableInBytes,
+			"disk_used_percent":       diskUsedPercent,
+			"cpu_percent":             node.Os.Cpu.Percent,
+			"load_average_1m":         node.Os.Cpu.LoadAverage["1m"],
+		})
+	}
+	return
+}
+
+func toJsonMap(value interface{}) (ret map[string]interface{}, err error) {
+	var data []byte
+	if data, err = json.Marshal(value); err == nil {
+		err = json.Unmarshal(data, &ret)
+	}
+	return
+}
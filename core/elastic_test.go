@@ -0,0 +1,119 @@
+package core
+
+import (
+	"encoding/json"
+	"github.com/eugeis/gee/as"
+	"gopkg.in/olivere/elastic.v5"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestElasticUrls(t *testing.T) {
+	AssertEqual(t, (&Elastic{Host: "localhost", Port: 9200}).urls()[0], "http://localhost:9200", nil)
+	AssertEqual(t, (&Elastic{Host: "localhost", Port: 9200, Tls: &Tls{}}).urls()[0], "https://localhost:9200", nil)
+	AssertEqual(t, len((&Elastic{Urls: []string{"https://node1:9200", "https://node2:9200"}}).urls()), 2, nil)
+}
+
+func TestElasticApiKey(t *testing.T) {
+	var authorization string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authorization = r.Header.Get("Authorization")
+	}))
+	defer server.Close()
+
+	client := &http.Client{Transport: &apiKeyTransport{
+		apiKey: encodeApiKey(as.Access{User: "id", Password: "key"}), transport: http.DefaultTransport}}
+	req, _ := http.NewRequest(http.MethodGet, server.URL, nil)
+	_, err := client.Do(req)
+	AssertEqual(t, err, nil, ErrorMessageBuilder)
+	AssertEqual(t, authorization, "ApiKey aWQ6a2V5", nil)
+	AssertEqual(t, req.Header.Get("Authorization"), "", nil)
+
+	AssertEqual(t, encodeApiKey(as.Access{Password: "aWQ6a2V5"}), "aWQ6a2V5", nil)
+}
+
+func TestExtractAccessKeysElastic(t *testing.T) {
+	config := &Config{Elastic: []*Elastic{{AccessKey: "elastic", Tls: &Tls{CertAccessKey: "elasticCert"}},
+		{ApiKeyAccessKey: "elasticApiKey"}}}
+	AssertEqual(t, len(config.ExtractAccessKeys()), 3, nil)
+}
+
+func TestElasticAggregationRows(t *testing.T) {
+	aggs := elastic.Aggregations{}
+	for name, data := range map[string]string{
+		"levels": `{"buckets": [{"key": "ERROR", "doc_count": 3, "avg_latency": {"value": 12.5}},
+			{"key": "WARN", "doc_count": 7, "latency": {"min": 1, "max": 9}}]}`,
+		"errors": `{"buckets": {"db": {"doc_count": 2}, "http": {"doc_count": 0}}}`,
+		"max_latency": `{"value": 150}`,
+	} {
+		raw := json.RawMessage(data)
+		aggs[name] = &raw
+	}
+
+	rows, err := aggregationRows(aggs)
+	AssertEqual(t, err, nil, ErrorMessageBuilder)
+	AssertEqual(t, len(rows), 5, nil)
+
+	AssertEqual(t, rows[0]["aggregation"], "errors", nil)
+	AssertEqual(t, rows[0]["key"], "db", nil)
+	AssertEqual(t, rows[0]["doc_count"], float64(2), nil)
+	AssertEqual(t, rows[2]["avg_latency"], 12.5, nil)
+	AssertEqual(t, rows[3]["latency.max"], float64(9), nil)
+	AssertEqual(t, rows[4]["aggregation"], "max_latency", nil)
+	AssertEqual(t, rows[4]["value"], float64(150), nil)
+}
+
+func TestElasticIndexAndNodeRows(t *testing.T) {
+	health := &elastic.ClusterHealthResponse{Indices: map[string]*elastic.ClusterIndexHealth{
+		"logs": {Status: "yellow", NumberOfShards: 5, UnassignedShards: 5},
+		"apps": {Status: "green", NumberOfShards: 1}}}
+	indices, err := indexRows(health, []byte(`{"indices": {"logs": {"primaries": {"docs": {"count": 100},
+		"store": {"size_in_bytes": 2048}}, "total": {"docs": {"count": 100}, "store": {"size_in_bytes": 4096}}}}}`))
+	AssertEqual(t, err, nil, ErrorMessageBuilder)
+	AssertEqual(t, len(indices), 2, nil)
+	AssertEqual(t, indices[1]["index"], "logs", nil)
+	AssertEqual(t, indices[1]["status"], "yellow", nil)
+	AssertEqual(t, indices[1]["unassigned_shards"], float64(5), nil)
+	AssertEqual(t, indices[1]["docs_count"], int64(100), nil)
+	AssertEqual(t, indices[1]["store_size_in_bytes"], int64(4096), nil)
+
+	nodes, err := nodeRows([]byte(`{"nodes": {"n1": {"name": "node-1", "jvm": {"mem": {"heap_used_percent": 75}},
+		"fs": {"total": {"total_in_bytes": 1000, "available_in_bytes": 250}},
+		"os": {"cpu": {"percent": 12, "load_average": {"1m": 0.5}}}}}}`))
+	AssertEqual(t, err, nil, ErrorMessageBuilder)
+	AssertEqual(t, len(nodes), 1, nil)
+	AssertEqual(t, nodes[0]["heap_used_percent"], int64(75), nil)
+	AssertEqual(t, nodes[0]["disk_used_percent"], float64(75), nil)
+	AssertEqual(t, nodes[0]["load_average_1m"], 0.5, nil)
+}
+
+func TestElasticPingStrictness(t *testing.T) {
+	service := &ElasticService{elastic: &Elastic{Name: "elastic"}}
+	AssertEqual(t, service.checkHealthStatus("green"), nil, ErrorMessageBuilder)
+	AssertEqual(t, service.checkHealthStatus("yellow"), nil, ErrorMessageBuilder)
+	AssertEqual(t, service.checkHealthStatus("red") != nil, true, nil)
+
+	service.elastic.PingFailOnYellow = true
+	AssertEqual(t, service.checkHealthStatus("yellow") != nil, true, nil)
+}
+
+func TestElasticApiUrl(t *testing.T) {
+	apiUrl, err := elasticApiUrl("_cluster/pending_tasks?local=true")
+	AssertEqual(t, err, nil, ErrorMessageBuilder)
+	AssertEqual(t, apiUrl.Path, "/_cluster/pending_tasks", nil)
+	AssertEqual(t, apiUrl.Query().Get("local"), "true", nil)
+
+	for _, path := range []string{"/_cat/shards", "/_nodes", "/_nodes/stats/jvm"} {
+		_, err = elasticApiUrl(path)
+		AssertEqual(t, err, nil, ErrorMessageBuilder)
+	}
+	for _, path := range []string{"/logs/_search", "/_security/user", "/_cat/../_search", "/_catalog", "/"} {
+		_, err = elasticApiUrl(path)
+		AssertEqual(t, err != nil, true, nil)
+	}
+
+	service := &ElasticService{elastic: &Elastic{Name: "elastic"}}
+	_, err = service.NewСheck(&ValidationRequest{Kind: ElasticApi, Query: "/_security/user"})
+	AssertEqual(t, err != nil, true, nil)
+}
@@ -7,7 +7,6 @@ import (
 	"gopkg.in/Knetic/govaluate.v2"
 	"io"
 	"os"
-	"path/filepath"
 	"regexp"
 	"strings"
 	"time"
@@ -46,11 +45,11 @@ func (o *Eye) registerExporters() {
 func (o *Eye) registerFileExporter(exporterFullName string, serviceName string, exporter *FileExporter) {
 	var err error
 	var service Service
-	if service, err = o.serviceFactory.Find(serviceName); err == nil {
+	if service, err = o.findExportService(serviceName, exporter.Target); err == nil {
 		var item Exporter
 		var eval *govaluate.EvaluableExpression
 		eval, err = compileEval(exporter.SourceFileExpr)
-		request := &ExportRequest{Query: exporter.Query, EvalExpr: exporter.EvalExpr, Convert: func(row map[string]interface{}) (ret io.Reader, err error) {
+		request := &ExportRequest{Query: exporter.Query, Params: exporter.Params, EvalExpr: exporter.EvalExpr, Listing: exporter.Listing, Convert: func(row map[string]interface{}) (ret io.Reader, err error) {
 			var evalResult interface{}
 			if evalResult, err = eval.Eval(&MapQueryResult{row}); err == nil {
 				var fileName string
@@ -73,28 +72,32 @@ func (o *Eye) registerFileExporter(exporterFullName string, serviceName string,
 			return
 		},
 			CreateOut: func(params map[string]string) (ret io.WriteCloser, err error) {
-				fileName := filepath.Join(o.config.ExportFolder, fmt.Sprintf("%v_%v.zip", exporterFullName, time.Now().Unix()))
-				return os.Create(fileName)
+				fileName := fmt.Sprintf("%v_%v.zip", exporterFullName, time.Now().Unix())
+				return o.createExportOut(exporter.Target, fileName)
 			},
 		}
 		if item, err = service.NewExporter(request); err == nil {
-			o.exporters[exporterFullName] = item
+			o.exporters[exporterFullName] = &paramsExporter{Exporter: item, params: exporter.Params}
 		}
 	}
-
+	if err != nil {
+		Log.Info("Can't build exporter '%v' because: %v", exporterFullName, err)
+	}
 }
 
 func (o *Eye) registerFieldExporter(exporterFullName string, serviceName string, exporter *FieldsExporter) {
 	var err error
 	var service Service
-	if service, err = o.serviceFactory.Find(serviceName); err == nil {
+	if service, err = o.findExportService(serviceName, exporter.Target); err == nil {
 		var item Exporter
-		request := &ExportRequest{Query: exporter.Query, Convert: func(row map[string]interface{}) (ret io.Reader, err error) {
+		request := &ExportRequest{Query: exporter.Query, Params: exporter.Params, Listing: exporter.Listing, Convert: func(row map[string]interface{}) (ret io.Reader, err error) {
 			var line bytes.Buffer
 			for _, field := range exporter.Fields {
 				if val, ok := row[field]; ok {
 					if str, ok := val.(string); ok {
 						line.WriteString(strings.Trim(str, "\r\n"))
+					} else if date, ok := val.(time.Time); ok {
+						line.WriteString(date.Format(timeLayouts[LayoutDateTime]))
 					} else {
 						line.WriteString(fmt.Sprintf("%v", val))
 					}
@@ -111,7 +114,7 @@ func (o *Eye) registerFieldExporter(exporterFullName string, serviceName string,
 				if params != nil && len(params) > 0 {
 					var nameBuffer bytes.Buffer
 					nameBuffer.WriteString(exporterFullName)
-					for _, v := range params {
+					for _, v := range sortedParamValues(params) {
 						nameBuffer.WriteString("_")
 						nameBuffer.WriteString(v)
 					}
@@ -122,14 +125,13 @@ func (o *Eye) registerFieldExporter(exporterFullName string, serviceName string,
 				}
 				fileName = fileNamePattern.ReplaceAllString(fileName, "_")
 				fileName = strings.Replace(fileName, "__", "_", -1)
-				fileName = filepath.Join(o.config.ExportFolder, fileName)
 
-				return os.Create(fileName)
+				return o.createExportOut(exporter.Target, fileName)
 			},
 		}
 
 		if item, err = service.NewExporter(request); err == nil {
-			o.exporters[exporterFullName] = item
+			o.exporters[exporterFullName] = &paramsExporter{Exporter: item, params: exporter.Params}
 		}
 	}
 	if err != nil {
@@ -137,3 +139,24 @@ func (o *Eye) registerFieldExporter(exporterFullName string, serviceName string,
 	}
 	return
 }
+
+//findExportService returns the service, if the target of the exporter is valid
+func (o *Eye) findExportService(serviceName string, target *ExportTarget) (ret Service, err error) {
+	if err = target.validate(); err == nil {
+		ret, err = o.serviceFactory.Find(serviceName)
+	}
+	return
+}
+
+//paramsExporter validates the params against the declared ones before export
+type paramsExporter struct {
+	Exporter
+	params []*Param
+}
+
+func (o *paramsExporter) Export(params map[string]string) (err error) {
+	if params, err = validateParams(o.params, params); err == nil {
+		err = o.Exporter.Export(params)
+	}
+	return
+}
@@ -37,6 +37,19 @@ func (o *Eye) UpdateConfig(config *Config) {
 	o.reloadServiceFactory()
 }
 
+//Stats returns the connection pool stats of the sql services
+func (o *Eye) Stats() (ret map[string]map[string]interface{}) {
+	ret = make(map[string]map[string]interface{})
+	for _, item := range o.config.MySql {
+		if service, err := o.serviceFactory.Find(item.Name); err == nil {
+			if mySql, ok := service.(*MySqlService); ok {
+				ret[item.Name] = mySql.poolStats()
+			}
+		}
+	}
+	return
+}
+
 func (o *Eye) Ping(serviceName string) (err error) {
 	var service Service
 	if service, err = o.serviceFactory.Find(serviceName); err == nil {
@@ -54,6 +67,16 @@ func (o *Eye) Check(checkName string) (err error) {
 	return
 }
 
+//CheckDiff returns the diff report of a compare check
+func (o *Eye) CheckDiff(checkName string) (ret *DiffReport, err error) {
+	if check, ok := o.checks[checkName]; ok {
+		ret, err = diffOf(check)
+	} else {
+		err = errors.New(fmt.Sprintf("There is no check '%v' available", checkName))
+	}
+	return
+}
+
 func (o *Eye) Export(exportName string, params map[string]string) (err error) {
 	if exporter, ok := o.exporters[exportName]; ok {
 		err = exporter.Export(params)
@@ -158,3 +181,30 @@ func (o *Eye) CompareAll(serviceNames []string, req *ValidationRequest) (err err
 	}
 	return
 }
+
+func (o *Eye) CompareRunningDiff(serviceNames []string, req *ValidationRequest) (ret *DiffReport, err error) {
+	var check Check
+	if check, err = o.getOrBuildCompareCheck(req.ChecksKey("running", serviceNames), serviceNames,
+		true, req); err == nil {
+		ret, err = diffOf(check)
+	}
+	return
+}
+
+func (o *Eye) CompareAllDiff(serviceNames []string, req *ValidationRequest) (ret *DiffReport, err error) {
+	var check Check
+	if check, err = o.getOrBuildCompareCheck(req.ChecksKey("all", serviceNames), serviceNames,
+		false, req); err == nil {
+		ret, err = diffOf(check)
+	}
+	return
+}
+
+func diffOf(check Check) (ret *DiffReport, err error) {
+	if multiCheck, ok := check.(*MultiCheck); ok {
+		ret, err = multiCheck.Diff()
+	} else {
+		err = errors.New(fmt.Sprintf("The check '%v' is not a compare check", check.Info()))
+	}
+	return
+}
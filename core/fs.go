@@ -5,9 +5,9 @@ import (
 	"github.com/eugeis/eye/integ"
 	"gopkg.in/Knetic/govaluate.v2"
 	"io"
-	"io/ioutil"
 	"os"
 	"path/filepath"
+	"strings"
 	"time"
 	"fmt"
 	"errors"
@@ -55,93 +55,131 @@ func (o *FsService) Ping() (err error) {
 }
 
 func (o *FsService) Files(file string) (ret []*FileInfo, err error) {
-	var fileInfo os.FileInfo
-
-	if fileInfo, err = os.Stat(file); err == nil {
-		if fileInfo.IsDir() {
-			var files []os.FileInfo
-			files, err = ioutil.ReadDir(file)
-			ret = make([]*FileInfo, len(files))
-			for i, entry := range files {
-				ret[i] = toFileInfo(entry, file)
+	return o.ListFiles(file, nil, 1)
+}
+
+//FilesWithFilter lists the files recursively, without directories, which fulfil the eval; unreadable entries are included
+func (o *FsService) FilesWithFilter(file string, listing *FileListing, eval *govaluate.EvaluableExpression) (
+	ret []*FileInfo, err error) {
+
+	var items []*FileInfo
+	if items, err = o.exportFiles(file, listing, -1); err == nil {
+		ret = make([]*FileInfo, 0)
+		for _, fileInfo := range items {
+			if len(fileInfo.Error) > 0 {
+				ret = append(ret, fileInfo)
+				continue
+			}
+			if fileInfo.IsDir {
+				continue
+			}
+			var evalResult interface{}
+			if evalResult, err = eval.Eval(&MapQueryResult{fileInfo.ToMap()}); err != nil {
+				return
+			}
+			if matched, isBool := evalResult.(bool); !isBool {
+				err = errors.New(fmt.Sprintf("The filter expression must evaluate to bool, but is '%v' for %v",
+					evalResult, fileInfo.RelPath))
+				return
+			} else if matched {
+				ret = append(ret, fileInfo)
+				Log.Debug("added %s", fileInfo.Name)
 			}
-		} else {
-			ret = make([]*FileInfo, 1)
-			ret[0] = toFileInfo(fileInfo, file)
 		}
 	}
 	return
 }
 
-func (o *FsService) FilesWithFilter(file string, eval *govaluate.EvaluableExpression) (ret []*FileInfo, err error) {
-	var fileInfo os.FileInfo
-	if fileInfo, err = os.Stat(file); err == nil {
-		ret = make([]*FileInfo, 0)
-		if fileInfo.IsDir() {
-			err = filepath.Walk(file, func(path string, f os.FileInfo, e error) (err error) {
-				fileInfo := toFileInfo(f, file)
-
-				var evalResult interface{}
-				if evalResult, err = eval.Eval(&MapQueryResult{fileInfo.ToMap()}); err == nil && !fileInfo.IsDir {
-					if evalResult.(bool) {
-						ret = append(ret, fileInfo)
-						Log.Debug("added %s", fileInfo.Name)
-					}
-				}
-
-				return err
-			})
-		}
+//buildPath joins the path element to the file of the service, the result must not leave it, e.g. by '..'
+func (o *FsService) buildPath(pathElement string) (ret string, err error) {
+	if len(pathElement) == 0 {
+		ret = o.Fs.File
+		return
+	}
+	ret = filepath.Join(o.Fs.File, pathElement)
+	var rel string
+	if rel, err = filepath.Rel(o.Fs.File, ret); err == nil &&
+		(rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator))) {
+		err = errors.New(fmt.Sprintf("The path '%v' is outside of %v", pathElement, o.Name()))
 	}
 	return
 }
 
-func (o *FsService) buildPath(pathElement string) string {
-	var filePath string
-	if len(pathElement) > 0 {
-		filePath = filepath.Join(o.Fs.File, pathElement)
-	} else {
-		filePath = o.Fs.File
+//validatePathParams rejects values of the params used in the path template with path separators or '..',
+//they must not navigate in the file system; other params, e.g. used only in the eval expression, are not checked
+func validatePathParams(pathTemplate string, params map[string]string) (err error) {
+	for name, value := range params {
+		if !strings.Contains(pathTemplate, fmt.Sprintf("@@%v@@", strings.ToUpper(name))) {
+			continue
+		}
+		if strings.Contains(value, "..") || strings.ContainsAny(value, `/\`) {
+			err = errors.New(fmt.Sprintf(
+				"The value '%v' of the parameter '%v' must not contain path separators or '..'", value, name))
+			return
+		}
 	}
-	return filePath
+	return
 }
 
-func (o *FsService) queryToWriter(file string, writer eio.MapWriter) (err error) {
+func (o *FsService) queryToWriter(file string, listing *FileListing, writer eio.MapWriter) (err error) {
 	var items []*FileInfo
-	if items, err = o.Files(file); err == nil {
-		for _, fileInfo := range items {
-			writer.WriteMap(fileInfo.ToMap())
-		}
+	if items, err = o.ListFiles(file, listing, 1); err == nil {
+		writeFiles(items, writer)
 	}
 	return
 }
 
-func (o *FsService) queryEvalToWriter(file string, eval *govaluate.EvaluableExpression, writer io.Writer) (err error) {
-	var items []*FileInfo
-	var osFileInfo os.FileInfo
-	var header *zip.FileHeader
-	var zipWriter io.Writer
-	var fileToZip *os.File
+func writeFiles(items []*FileInfo, writer eio.MapWriter) {
+	for _, fileInfo := range items {
+		writer.WriteMap(fileInfo.ToMap())
+	}
+}
 
+func zipFiles(file string, items []*FileInfo, writer io.Writer) (err error) {
 	archive := zip.NewWriter(writer)
 	defer archive.Close()
-	defer fileToZip.Close()
 
-	if items, err = o.FilesWithFilter(file, eval); err == nil {
-		for _, fileInfo := range items {
-			fullpath := fileInfo.Path + "/" + fileInfo.Name
-			osFileInfo, err = os.Stat(fullpath)
-			header, err = zip.FileInfoHeader(osFileInfo)
-			header.Method = zip.Deflate
-
-			zipWriter, err = archive.CreateHeader(header)
-			fileToZip, err = os.Open(fullpath)
-			_, err = io.Copy(zipWriter, fileToZip)
+	for _, fileInfo := range items {
+		if len(fileInfo.Error) > 0 {
+			Log.Info("Skip '%v' in the export of %v: %v", fileInfo.RelPath, file, fileInfo.Error)
+			continue
+		}
+		if err = zipFile(archive, fileInfo); err != nil {
+			return
 		}
 	}
 	return
 }
 
+//zipFile adds the file as entry with the slash separated path relative to the listed directory
+func zipFile(archive *zip.Writer, fileInfo *FileInfo) (err error) {
+	file := filepath.Join(fileInfo.Path, fileInfo.Name)
+	var osFileInfo os.FileInfo
+	if osFileInfo, err = os.Stat(file); err != nil {
+		return
+	}
+	var header *zip.FileHeader
+	if header, err = zip.FileInfoHeader(osFileInfo); err != nil {
+		return
+	}
+	header.Method = zip.Deflate
+	if len(fileInfo.RelPath) > 0 {
+		header.Name = fileInfo.RelPath
+	}
+
+	var zipWriter io.Writer
+	if zipWriter, err = archive.CreateHeader(header); err != nil {
+		return
+	}
+	var fileToZip *os.File
+	if fileToZip, err = os.Open(file); err != nil {
+		return
+	}
+	defer fileToZip.Close()
+	_, err = io.Copy(zipWriter, fileToZip)
+	return
+}
+
 func (o *FsService) NewExecutor(req *CommandRequest) (ret Executor, err error) {
 	return nil, errors.New(fmt.Sprintf("Not implemented yet in %v", o.Name()))
 }
@@ -156,11 +194,22 @@ func (o *FsService) newСheck(req *ValidationRequest) (ret *FsCheck, err error)
 		return
 	}
 
+	var aggr *aggregation
+	if aggr, err = compileAggr(req.AggrExpr); err != nil {
+		return
+	}
+
+	var file string
+	if file, err = o.buildPath(req.Query); err != nil {
+		return
+	}
+
 	ret = &FsCheck{
 		info:    req.CheckKey("Fs"),
 		service: o,
-		file:    o.buildPath(req.Query),
-		eval:    eval, all: req.All}
+		file:    file,
+		listing: req.Listing,
+		eval:    eval, all: req.All, aggr: aggr}
 	ret.files = integ.NewObjectCache(func() (interface{}, error) { return ret.Files() })
 	return
 }
@@ -174,9 +223,11 @@ func (o *FsService) NewExporter(req *ExportRequest) (ret Exporter, err error) {
 type FsCheck struct {
 	info    string
 	file    string
+	listing *FileListing
 	all     bool
 	service *FsService
 	eval    *govaluate.EvaluableExpression
+	aggr    *aggregation
 	files   integ.ObjectCache
 }
 
@@ -185,13 +236,13 @@ func (o *FsCheck) Info() string {
 }
 
 func (o *FsCheck) Validate() (err error) {
-	return validate(o, o.eval, o.all)
+	return validate(o, o.eval, o.all, o.aggr)
 }
 
 func (o *FsCheck) Query() (ret QueryResults, err error) {
 	if err = o.service.Init(); err == nil {
 		writer := NewQueryResultMapWriter()
-		if err = o.service.queryToWriter(o.file, writer); err == nil {
+		if err = o.service.queryToWriter(o.file, o.listing, writer); err == nil {
 			ret = writer.Data
 		}
 	}
@@ -199,7 +250,7 @@ func (o *FsCheck) Query() (ret QueryResults, err error) {
 }
 
 func (o *FsCheck) Files() (ret []*FileInfo, err error) {
-	return o.service.Files(o.file)
+	return o.service.ListFiles(o.file, o.listing, 1)
 }
 
 func toFileInfo(item os.FileInfo, parent string) *FileInfo {
@@ -221,11 +272,16 @@ type FileInfo struct {
 	ModTime time.Time
 	IsDir   bool
 	Path    string
+	//path relative to the listed directory
+	RelPath string
+	//unreadable entries are listed with the error
+	Error string
 }
 
 func (o *FileInfo) ToMap() (ret map[string]interface{}) {
 	return map[string]interface{}{
-		"Name": o.Name, "Size": o.Size, "Mode": o.Mode, "ModTime": o.ModTime, "IsDir": o.IsDir, "Path": o.Path}
+		"Name": o.Name, "Size": o.Size, "Mode": o.Mode, "ModTime": o.ModTime, "IsDir": o.IsDir, "Path": o.Path,
+		"RelPath": o.RelPath, "Error": o.Error}
 }
 
 type fsExporter struct {
@@ -243,18 +299,39 @@ func (o *fsExporter) Export(params map[string]string) (err error) {
 		return
 	}
 
+	if err = validatePathParams(o.req.Query, params); err != nil {
+		return
+	}
+	var file string
+	if file, err = o.service.buildPath(prepareQuery(o.req.Query, params, nil)); err != nil {
+		return
+	}
+
+	//the files are listed before the output is created, an incomplete listing fails the export
+	var items []*FileInfo
+	var evalExpr *govaluate.EvaluableExpression
+	if o.req.EvalExpr != "" {
+		if evalExpr, err = compileEval(o.req.EvalExpr); err != nil {
+			return
+		}
+		items, err = o.service.FilesWithFilter(file, o.req.Listing, evalExpr)
+	} else {
+		items, err = o.service.exportFiles(file, o.req.Listing, 1)
+	}
+	if err != nil {
+		return
+	}
+
 	var out io.WriteCloser
 	if out, err = o.req.CreateOut(params); err != nil {
 		return
 	}
 
-	defer out.Close()
-	if o.req.EvalExpr != "" {
-		evalExpr, _ := compileEval(o.req.EvalExpr)
-		err = o.service.queryEvalToWriter(o.service.buildPath(o.req.Query), evalExpr, out)
+	defer closeExportOut(out, &err)
+	if evalExpr != nil {
+		err = zipFiles(file, items, out)
 	} else {
-		writeCloseMapWriter := &eio.WriteCloserMapWriter{Convert: o.req.Convert, Out: out}
-		err = o.service.queryToWriter(o.service.buildPath(o.req.Query), writeCloseMapWriter)
+		writeFiles(items, &eio.WriteCloserMapWriter{Convert: o.req.Convert, Out: out})
 	}
 	return
 }
@@ -0,0 +1,212 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+const defaultMaxFiles = 10000
+
+// FileListing controls, which files of a directory are listed by fs checks and exports.
+type FileListing struct {
+	//glob of the paths relative to the directory, '**' matches any directories, e.g. '**/*.log'
+	Glob string
+	//depth of the listed directories, -1 for unlimited; default is 1 (the entries of the directory),
+	//the segments of the glob or unlimited for globs with '**'
+	MaxDepth       int
+	FollowSymlinks bool
+	//globs of excluded relative paths, excluded directories are not listed, e.g. 'tmp' or '**/*.bak'
+	Exclude []string
+	//maximal count of listed files without directories; checks: default 10000, the listing is truncated by a row
+	//with Error; exports: unlimited by default, they fail, if the count is exceeded
+	MaxFiles int
+}
+
+func (o *FileListing) maxDepth(defaultDepth int) int {
+	switch {
+	case o.MaxDepth != 0:
+		return o.MaxDepth
+	case strings.Contains(o.Glob, "**"):
+		return -1
+	case len(o.Glob) > 0:
+		return len(strings.Split(o.Glob, "/"))
+	}
+	return defaultDepth
+}
+
+func (o *FileListing) maxFiles(defaultMaxFiles int) int {
+	if o.MaxFiles > 0 {
+		return o.MaxFiles
+	}
+	return defaultMaxFiles
+}
+
+func (o *FileListing) excluded(relPath string) bool {
+	for _, exclude := range o.Exclude {
+		if matchGlob(exclude, relPath) {
+			return true
+		}
+	}
+	return false
+}
+
+//fileWalker lists the files, unreadable entries are listed with the error
+type fileWalker struct {
+	listing  *FileListing
+	maxDepth int
+	maxFiles int
+	visited  map[string]bool
+	files    []*FileInfo
+	//count of the files without directories
+	count     int
+	truncated bool
+}
+
+// ListFiles lists the file, or the entries of the directory by the listing, defaultDepth is used if the listing
+// defines none. Errors of unreadable entries are listed as FileInfo with Error.
+func (o *FsService) ListFiles(file string, listing *FileListing, defaultDepth int) (ret []*FileInfo, err error) {
+	ret, _, err = o.listFiles(file, listing, defaultDepth, defaultMaxFiles)
+	return
+}
+
+//exportFiles lists the files for exports, they are not limited by default and fail, if the listing is truncated
+func (o *FsService) exportFiles(file string, listing *FileListing, defaultDepth int) (ret []*FileInfo, err error) {
+	var truncated bool
+	if ret, truncated, err = o.listFiles(file, listing, defaultDepth, -1); err == nil && truncated {
+		err = errors.New(fmt.Sprintf("The export of %v exceeds %v files", file, listing.MaxFiles))
+	}
+	return
+}
+
+//listFiles lists at most maxFiles files (-1 for unlimited), more files are indicated by truncated and a row with Error
+func (o *FsService) listFiles(file string, listing *FileListing, defaultDepth int, defaultMaxFiles int) (
+	ret []*FileInfo, truncated bool, err error) {
+
+	var fileInfo os.FileInfo
+	if fileInfo, err = os.Stat(file); err != nil {
+		return
+	}
+	if !fileInfo.IsDir() {
+		ret = []*FileInfo{toFileInfo(fileInfo, filepath.Dir(file))}
+		return
+	}
+
+	if listing == nil {
+		listing = &FileListing{}
+	}
+	walker := &fileWalker{listing: listing, maxDepth: listing.maxDepth(defaultDepth),
+		maxFiles: listing.maxFiles(defaultMaxFiles), visited: make(map[string]bool), files: make([]*FileInfo, 0)}
+	walker.enter(file)
+	walker.walk(file, "", 1)
+	ret, truncated = walker.files, walker.truncated
+	return
+}
+
+func (o *fileWalker) walk(dir string, relDir string, depth int) {
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		o.addError(dir, relDir, err)
+		return
+	}
+
+	for _, entry := range entries {
+		if o.truncated {
+			return
+		}
+		file := filepath.Join(dir, entry.Name())
+		relPath := path.Join(relDir, entry.Name())
+		if o.listing.excluded(relPath) {
+			continue
+		}
+
+		info := entry
+		if entry.Mode()&os.ModeSymlink != 0 && o.listing.FollowSymlinks {
+			if info, err = os.Stat(file); err != nil {
+				o.addError(file, relPath, err)
+				continue
+			}
+		}
+
+		if len(o.listing.Glob) == 0 || matchGlob(o.listing.Glob, relPath) {
+			if !info.IsDir() && o.full() {
+				return
+			}
+			item := toFileInfo(info, dir)
+			item.RelPath = relPath
+			o.files = append(o.files, item)
+			if !info.IsDir() {
+				o.count++
+			}
+		}
+
+		if info.IsDir() && (o.maxDepth < 0 || depth < o.maxDepth) && o.enter(file) {
+			o.walk(file, relPath, depth+1)
+		}
+	}
+}
+
+//enter returns false for already visited directories, e.g. because of symlink cycles
+func (o *fileWalker) enter(dir string) bool {
+	realDir, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		realDir = dir
+	}
+	if o.visited[realDir] {
+		Log.Debug("The directory '%v' is already listed", dir)
+		return false
+	}
+	o.visited[realDir] = true
+	return true
+}
+
+//full returns true, if the next file exceeds maxFiles, the listing is truncated then
+func (o *fileWalker) full() bool {
+	if o.maxFiles < 0 || o.count < o.maxFiles {
+		return false
+	}
+	if !o.truncated {
+		o.truncated = true
+		o.files = append(o.files, &FileInfo{Error: fmt.Sprintf("The listing is truncated after %v files", o.maxFiles)})
+	}
+	return true
+}
+
+func (o *fileWalker) addError(file string, relPath string, err error) {
+	if !o.full() {
+		o.files = append(o.files, &FileInfo{Name: filepath.Base(file), Path: filepath.Dir(file), RelPath: relPath,
+			Error: err.Error()})
+		o.count++
+	}
+}
+
+// matchGlob matches the slash separated path against the pattern, '**' matches any count of path segments,
+// other segments are matched by path.Match
+func matchGlob(pattern string, relPath string) bool {
+	return matchGlobSegments(strings.Split(pattern, "/"), strings.Split(relPath, "/"))
+}
+
+func matchGlobSegments(patterns []string, segments []string) bool {
+	for len(patterns) > 0 {
+		if patterns[0] == "**" {
+			for i := 0; i <= len(segments); i++ {
+				if matchGlobSegments(patterns[1:], segments[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(segments) == 0 {
+			return false
+		}
+		if matched, err := path.Match(patterns[0], segments[0]); err != nil || !matched {
+			return false
+		}
+		patterns, segments = patterns[1:], segments[1:]
+	}
+	return len(segments) == 0
+}
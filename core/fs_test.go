@@ -1,6 +1,13 @@
 package core
 
 import (
+	"archive/zip"
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
 	"testing"
 )
 
@@ -18,3 +25,133 @@ func TestFileSystemService(t *testing.T) {
 	}
 
 }
+
+func TestMatchGlob(t *testing.T) {
+	for _, item := range []struct {
+		pattern string
+		path    string
+		matched bool
+	}{
+		{"*.log", "app.log", true},
+		{"*.log", "logs/app.log", false},
+		{"**/*.log", "app.log", true},
+		{"**/*.log", "logs/2020/app.log", true},
+		{"logs/**", "logs/2020/app.log", true},
+		{"logs/**/app.log", "logs/app.log", true},
+		{"logs/*/app.log", "logs/app.log", false},
+		{"**", "logs", true},
+	} {
+		AssertEqual(t, matchGlob(item.pattern, item.path), item.matched, ErrorMessageBuilder)
+	}
+}
+
+func TestFsListFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "eye_fs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	for _, file := range []string{"app.log", "logs/a.log", "logs/b.txt", "logs/2020/c.log", "tmp/d.log"} {
+		file = filepath.Join(dir, filepath.FromSlash(file))
+		os.MkdirAll(filepath.Dir(file), 0755)
+		ioutil.WriteFile(file, []byte("eye"), 0644)
+	}
+	os.Symlink(dir, filepath.Join(dir, "logs", "loop"))
+
+	service := &FsService{Fs: &Fs{File: dir}}
+	relPaths := func(listing *FileListing) string {
+		files, err := service.ListFiles(dir, listing, 1)
+		AssertEqual(t, err, nil, ErrorMessageBuilder)
+		var ret []string
+		for _, file := range files {
+			if len(file.Error) > 0 {
+				ret = append(ret, "error")
+			} else {
+				ret = append(ret, file.RelPath)
+			}
+		}
+		sort.Strings(ret)
+		return strings.Join(ret, ",")
+	}
+
+	AssertEqual(t, relPaths(nil), "app.log,logs,tmp", ErrorMessageBuilder)
+	AssertEqual(t, relPaths(&FileListing{Glob: "**/*.log", Exclude: []string{"tmp"}}),
+		"app.log,logs/2020/c.log,logs/a.log", ErrorMessageBuilder)
+	AssertEqual(t, relPaths(&FileListing{Glob: "**/*.log", MaxDepth: 2}),
+		"app.log,logs/a.log,tmp/d.log", ErrorMessageBuilder)
+	AssertEqual(t, relPaths(&FileListing{Glob: "*/*.log"}), "logs/a.log,tmp/d.log", ErrorMessageBuilder)
+	AssertEqual(t, relPaths(&FileListing{Glob: "**/*.log", FollowSymlinks: true, Exclude: []string{"tmp/**"}}),
+		"app.log,logs/2020/c.log,logs/a.log", ErrorMessageBuilder)
+	AssertEqual(t, relPaths(&FileListing{MaxDepth: -1, MaxFiles: 3}),
+		"app.log,error,logs,logs/2020,logs/2020/c.log,logs/a.log", ErrorMessageBuilder)
+
+	//exports are not limited by default and fail, if the configured count is exceeded
+	files, err := service.exportFiles(dir, &FileListing{MaxDepth: -1}, 1)
+	AssertEqual(t, err, nil, ErrorMessageBuilder)
+	AssertEqual(t, len(files), 9, nil)
+	_, err = service.exportFiles(dir, &FileListing{MaxDepth: -1, MaxFiles: 6}, 1)
+	AssertEqual(t, err, nil, ErrorMessageBuilder)
+	_, err = service.exportFiles(dir, &FileListing{MaxDepth: -1, MaxFiles: 5}, 1)
+	AssertEqual(t, err != nil, true, nil)
+
+	os.Symlink(filepath.Join(dir, "missing"), filepath.Join(dir, "broken"))
+	AssertEqual(t, relPaths(&FileListing{FollowSymlinks: true}), "app.log,error,logs,tmp", ErrorMessageBuilder)
+}
+
+func TestFsZipFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "eye_fs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	for _, file := range []string{"a/x.log", "b/x.log", "b/y.txt"} {
+		file = filepath.Join(dir, filepath.FromSlash(file))
+		os.MkdirAll(filepath.Dir(file), 0755)
+		ioutil.WriteFile(file, []byte(file), 0644)
+	}
+
+	service := &FsService{Fs: &Fs{File: dir}}
+	eval, err := compileEval(`Name == "x.log"`)
+	AssertEqual(t, err, nil, ErrorMessageBuilder)
+	files, err := service.FilesWithFilter(dir, &FileListing{Glob: "**/*.log"}, eval)
+	AssertEqual(t, err, nil, ErrorMessageBuilder)
+
+	var buffer bytes.Buffer
+	AssertEqual(t, zipFiles(dir, files, &buffer), nil, ErrorMessageBuilder)
+	archive, err := zip.NewReader(bytes.NewReader(buffer.Bytes()), int64(buffer.Len()))
+	AssertEqual(t, err, nil, ErrorMessageBuilder)
+	var names []string
+	for _, entry := range archive.File {
+		names = append(names, entry.Name)
+	}
+	sort.Strings(names)
+	AssertEqual(t, strings.Join(names, ","), "a/x.log,b/x.log", nil)
+
+	eval, err = compileEval(`Name + "x"`)
+	AssertEqual(t, err, nil, ErrorMessageBuilder)
+	_, err = service.FilesWithFilter(dir, nil, eval)
+	AssertEqual(t, err != nil, true, nil)
+}
+
+func TestFsPathParams(t *testing.T) {
+	service := &FsService{Fs: &Fs{Name: "logs", File: filepath.FromSlash("/var/log/app")}}
+
+	file, err := service.buildPath("2020/app.log")
+	AssertEqual(t, err, nil, ErrorMessageBuilder)
+	AssertEqual(t, file, filepath.FromSlash("/var/log/app/2020/app.log"), nil)
+
+	_, err = service.buildPath("../../etc")
+	AssertEqual(t, err != nil, true, nil)
+
+	_, err = service.NewСheck(&ValidationRequest{Query: "../secrets"})
+	AssertEqual(t, err != nil, true, nil)
+
+	pathTemplate := "logs/@@DAY@@/@@NAME@@"
+	AssertEqual(t, validatePathParams(pathTemplate, map[string]string{"day": "2020-03-15"}), nil, ErrorMessageBuilder)
+	AssertEqual(t, validatePathParams(pathTemplate, map[string]string{"name": "../../etc"}) != nil, true, nil)
+	AssertEqual(t, validatePathParams(pathTemplate, map[string]string{"name": "a/b"}) != nil, true, nil)
+	AssertEqual(t, validatePathParams(pathTemplate, map[string]string{"name": `a\b`}) != nil, true, nil)
+	//params outside of the path, e.g. used by the eval expression, may contain separators
+	AssertEqual(t, validatePathParams(pathTemplate, map[string]string{"pattern": `^app/.*\.log$`}), nil,
+		ErrorMessageBuilder)
+}
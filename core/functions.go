@@ -0,0 +1,296 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"gopkg.in/Knetic/govaluate.v2"
+	"math"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// evalFunctions are available in all eval expressions, times are unix seconds and durations seconds:
+//  matches(text, pattern)      true, if the regular expression matches the text
+//  contains(text, part)        true, if the text contains the part, or the list the item
+//  lower(text)                 text in lower case
+//  len(value)                  length of a text, list or map
+// (govaluate spreads list parameters to function arguments, so a list with a single text has the length of the text)
+//  ageSeconds(time)            seconds since the time, e.g. ageSeconds(ModTime) > 3600
+//  now()                       current time
+//  parseTime(text[, layout])   time of the text, RFC3339 or the Go layout
+//  parseDuration(text)         duration of the text, e.g. '90s', '10m' or '1d'
+//  bytes(text)                 bytes of the size, e.g. '10MB', units are B, KB, MB, GB and TB (1024 based, KiB etc. as well)
+//  coalesce(value, ...)        first value, which is not nil
+//  abs(number)                 absolute value
+var evalFunctions = map[string]govaluate.ExpressionFunction{
+	"matches":       evalMatches,
+	"contains":      evalContains,
+	"lower":         evalLower,
+	"len":           evalLen,
+	"ageSeconds":    evalAgeSeconds,
+	"now":           evalNow,
+	"parseTime":     evalParseTime,
+	"parseDuration": evalParseDuration,
+	"bytes":         evalBytes,
+	"coalesce":      evalCoalesce,
+	"abs":           evalAbs,
+}
+
+var byteUnits = map[string]float64{
+	"":   1,
+	"B":  1,
+	"K":  1 << 10,
+	"KB": 1 << 10,
+	"M":  1 << 20,
+	"MB": 1 << 20,
+	"G":  1 << 30,
+	"GB": 1 << 30,
+	"T":  1 << 40,
+	"TB": 1 << 40,
+}
+
+var bytesPattern = regexp.MustCompile(`^\s*([0-9.]+)\s*([a-zA-Z]*)\s*$`)
+
+//maximal count of cached patterns, the patterns come from API eval expressions
+const maxEvalPatterns = 256
+
+//evalPatterns caches the compiled patterns of 'matches', the cache is cleared, if it is full
+var evalPatterns = struct {
+	items map[string]*regexp.Regexp
+	lock  sync.Mutex
+}{items: make(map[string]*regexp.Regexp)}
+
+func evalMatches(args ...interface{}) (ret interface{}, err error) {
+	if err = checkArgs("matches", args, 2, 2); err != nil {
+		return
+	}
+	pattern := fmt.Sprint(args[1])
+
+	evalPatterns.lock.Lock()
+	regExpr, ok := evalPatterns.items[pattern]
+	if !ok {
+		if regExpr, err = regexp.Compile(pattern); err == nil {
+			if len(evalPatterns.items) >= maxEvalPatterns {
+				evalPatterns.items = make(map[string]*regexp.Regexp)
+			}
+			evalPatterns.items[pattern] = regExpr
+		}
+	}
+	evalPatterns.lock.Unlock()
+
+	if err == nil {
+		ret = regExpr.MatchString(toText(args[0]))
+	}
+	return
+}
+
+func evalContains(args ...interface{}) (ret interface{}, err error) {
+	if len(args) < 2 {
+		return nil, checkArgs("contains", args, 2, 2)
+	}
+	//a list parameter is spread to the arguments
+	part := args[len(args)-1]
+	list := args[:len(args)-1]
+	if nested, ok := list[0].([]interface{}); ok && len(list) == 1 {
+		list = nested
+	} else if len(list) == 1 {
+		return strings.Contains(toText(list[0]), toText(part)), nil
+	}
+	for _, item := range list {
+		if reflect.DeepEqual(item, part) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func evalLower(args ...interface{}) (ret interface{}, err error) {
+	if err = checkArgs("lower", args, 1, 1); err == nil {
+		ret = strings.ToLower(toText(args[0]))
+	}
+	return
+}
+
+func evalLen(args ...interface{}) (ret interface{}, err error) {
+	//a list parameter is spread to the arguments
+	if len(args) != 1 {
+		return float64(len(args)), nil
+	}
+	if args[0] == nil {
+		return 0.0, nil
+	}
+	switch value := reflect.ValueOf(args[0]); value.Kind() {
+	case reflect.String, reflect.Slice, reflect.Array, reflect.Map:
+		ret = float64(value.Len())
+	default:
+		err = errors.New(fmt.Sprintf("len is not supported for '%v'", args[0]))
+	}
+	return
+}
+
+func evalAgeSeconds(args ...interface{}) (ret interface{}, err error) {
+	if err = checkArgs("ageSeconds", args, 1, 1); err != nil {
+		return
+	}
+	var value float64
+	if value, err = toUnixSeconds(args[0]); err == nil {
+		ret = unixSeconds(time.Now()) - value
+	}
+	return
+}
+
+func evalNow(args ...interface{}) (ret interface{}, err error) {
+	if err = checkArgs("now", args, 0, 0); err == nil {
+		ret = unixSeconds(time.Now())
+	}
+	return
+}
+
+func evalParseTime(args ...interface{}) (ret interface{}, err error) {
+	if err = checkArgs("parseTime", args, 1, 2); err != nil {
+		return
+	}
+	//govaluate converts date literals, e.g. '2020-03-15', to unix seconds already
+	if seconds, ok := args[0].(float64); ok {
+		return seconds, nil
+	}
+	layout := time.RFC3339
+	if len(args) == 2 {
+		layout = toText(args[1])
+	}
+	var value time.Time
+	if value, err = time.Parse(layout, toText(args[0])); err == nil {
+		ret = unixSeconds(value)
+	}
+	return
+}
+
+func evalParseDuration(args ...interface{}) (ret interface{}, err error) {
+	if err = checkArgs("parseDuration", args, 1, 1); err != nil {
+		return
+	}
+	text := strings.TrimSpace(toText(args[0]))
+	if strings.HasSuffix(text, "d") {
+		var days float64
+		if days, err = strconv.ParseFloat(strings.TrimSuffix(text, "d"), 64); err == nil {
+			ret = days * 24 * 3600
+		}
+		return
+	}
+	var value time.Duration
+	if value, err = time.ParseDuration(text); err == nil {
+		ret = value.Seconds()
+	}
+	return
+}
+
+func evalBytes(args ...interface{}) (ret interface{}, err error) {
+	if err = checkArgs("bytes", args, 1, 1); err != nil {
+		return
+	}
+	text := toText(args[0])
+	match := bytesPattern.FindStringSubmatch(text)
+	if match == nil {
+		err = errors.New(fmt.Sprintf("'%v' is not a valid size, e.g. 10MB", text))
+		return
+	}
+	unit, ok := byteUnits[strings.TrimSuffix(strings.ToUpper(match[2]), "IB")]
+	if !ok {
+		err = errors.New(fmt.Sprintf("The unit of '%v' is not supported, allowed are B, KB, MB, GB and TB", text))
+		return
+	}
+	var value float64
+	if value, err = strconv.ParseFloat(match[1], 64); err == nil {
+		ret = value * unit
+	}
+	return
+}
+
+func evalCoalesce(args ...interface{}) (ret interface{}, err error) {
+	for _, arg := range args {
+		if arg != nil {
+			return arg, nil
+		}
+	}
+	return
+}
+
+func evalAbs(args ...interface{}) (ret interface{}, err error) {
+	if err = checkArgs("abs", args, 1, 1); err != nil {
+		return
+	}
+	var value float64
+	if value, err = toFloat(args[0]); err == nil {
+		ret = math.Abs(value)
+	}
+	return
+}
+
+func checkArgs(function string, args []interface{}, min int, max int) (err error) {
+	if len(args) < min || len(args) > max {
+		if min == max {
+			err = errors.New(fmt.Sprintf("%v expects %v arguments, got %v", function, min, len(args)))
+		} else {
+			err = errors.New(fmt.Sprintf("%v expects %v to %v arguments, got %v", function, min, max, len(args)))
+		}
+	}
+	return
+}
+
+func toText(value interface{}) string {
+	if value == nil {
+		return ""
+	}
+	if text, ok := value.(string); ok {
+		return text
+	}
+	return fmt.Sprint(value)
+}
+
+func toFloat(value interface{}) (ret float64, err error) {
+	switch number := value.(type) {
+	case float64:
+		ret = number
+	case float32:
+		ret = float64(number)
+	case int:
+		ret = float64(number)
+	case int32:
+		ret = float64(number)
+	case int64:
+		ret = float64(number)
+	case uint64:
+		ret = float64(number)
+	case string:
+		ret, err = strconv.ParseFloat(number, 64)
+	case []byte:
+		ret, err = strconv.ParseFloat(string(number), 64)
+	default:
+		err = errors.New(fmt.Sprintf("'%v' is not a number", value))
+	}
+	return
+}
+
+//toUnixSeconds converts times, RFC3339 texts and unix seconds
+func toUnixSeconds(value interface{}) (ret float64, err error) {
+	switch item := value.(type) {
+	case time.Time:
+		ret = unixSeconds(item)
+	case string:
+		var parsed time.Time
+		if parsed, err = time.Parse(time.RFC3339, item); err == nil {
+			ret = unixSeconds(parsed)
+		}
+	default:
+		ret, err = toFloat(value)
+	}
+	return
+}
+
+func unixSeconds(value time.Time) float64 {
+	return float64(value.UnixNano()) / float64(time.Second)
+}
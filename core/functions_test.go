@@ -0,0 +1,84 @@
+package core
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestEvalFunctions(t *testing.T) {
+	row := &MapQueryResult{map[string]interface{}{
+		"Name":    "app-2020.log",
+		"Size":    int64(20 << 20),
+		"ModTime": time.Now().Add(-2 * time.Hour),
+		"Tags":    []interface{}{"db", "web"},
+		"Latency": -12.5,
+		"Created": time.Now().Add(-time.Minute).Format(time.RFC3339),
+	}}
+
+	for _, expr := range []string{
+		`matches(Name, "^app-\\d+\\.log$")`,
+		`contains(Name, "2020") && contains(Tags, "web") && !contains(Tags, "mail")`,
+		`lower("ERROR") == "error"`,
+		`len(Tags) == 2 && len(Name) == 12`,
+		`ageSeconds(ModTime) > parseDuration("1h") && ageSeconds(ModTime) < parseDuration("1d")`,
+		`now() - parseTime(Created) < 120`,
+		`parseTime("15.03.2020 10:30", "02.01.2006 15:04") == 1584268200`,
+		`parseTime("2020-03-15") < now()`,
+		`Size > bytes("10MB") && Size < bytes("1 GiB")`,
+		`coalesce(Missing, "default") == "default"`,
+		`abs(Latency) == 12.5`,
+	} {
+		eval, err := compileEval(expr)
+		AssertEqual(t, err, nil, ErrorMessageBuilder)
+
+		result, err := eval.Eval(row)
+		AssertEqual(t, err, nil, ErrorMessageBuilder)
+		AssertEqual(t, result, true, func(actual interface{}, expected interface{}) string {
+			return expr
+		})
+	}
+}
+
+func TestEvalFunctionsErrors(t *testing.T) {
+	for _, expr := range []string{`bytes("10XB") > 0`, `matches(Name) == true`, `parseDuration("ten") > 0`} {
+		eval, err := compileEval(expr)
+		AssertEqual(t, err, nil, ErrorMessageBuilder)
+
+		_, err = eval.Eval(&MapQueryResult{map[string]interface{}{"Name": "eye"}})
+		AssertEqual(t, err != nil, true, func(actual interface{}, expected interface{}) string {
+			return expr
+		})
+	}
+}
+
+func TestEvalPatternsCacheLimit(t *testing.T) {
+	for i := 0; i < 2*maxEvalPatterns; i++ {
+		result, err := evalMatches(fmt.Sprintf("value%v", i), fmt.Sprintf("^value%v$", i))
+		AssertEqual(t, err, nil, ErrorMessageBuilder)
+		AssertEqual(t, result, true, nil)
+	}
+	evalPatterns.lock.Lock()
+	count := len(evalPatterns.items)
+	evalPatterns.lock.Unlock()
+	AssertEqual(t, count <= maxEvalPatterns, true, nil)
+}
+
+func TestBracketDottedNames(t *testing.T) {
+	for expr, expected := range map[string]string{
+		`db.latencyMs < 200`:                     `[db.latencyMs] < 200`,
+		`status == "UP" && a.b.c_1 > 0.5`:        `status == "UP" && [a.b.c_1] > 0.5`,
+		`[db.latencyMs] < 200`:                   `[db.latencyMs] < 200`,
+		`Name == "app.log" || Name == 'a.b'`:     `Name == "app.log" || Name == 'a.b'`,
+		`Name == "say \"a.b\"" && x.y`:           `Name == "say \"a.b\"" && [x.y]`,
+		`Size > 1.5 && Name.Len() > 0 && Name.x`: `Size > 1.5 && Name.Len() > 0 && [Name.x]`,
+	} {
+		AssertEqual(t, bracketDottedNames(expr), expected, nil)
+	}
+
+	eval, err := compileEval(`db.latencyMs < 200 && db.status == "UP"`)
+	AssertEqual(t, err, nil, ErrorMessageBuilder)
+	result, err := eval.Eval(&MapQueryResult{map[string]interface{}{"db.latencyMs": 150, "db.status": "UP"}})
+	AssertEqual(t, err, nil, ErrorMessageBuilder)
+	AssertEqual(t, result, true, nil)
+}
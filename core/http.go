@@ -1,11 +1,19 @@
 package core
 
 import (
+	"bytes"
+	"context"
+	"crypto/tls"
 	"github.com/eugeis/eye/digest"
 	"fmt"
 	"io/ioutil"
 	"net/http"
+	"net/http/httptrace"
+	"net/url"
 	"regexp"
+	"strings"
+	"sync"
+	"text/template"
 	"time"
 	"github.com/eugeis/gee/as"
 	"gopkg.in/Knetic/govaluate.v2"
@@ -14,26 +22,59 @@ import (
 	"github.com/eugeis/gee/eio"
 )
 
+const (
+	AuthDigest = "digest"
+	AuthBasic  = "basic"
+	AuthBearer = "bearer"
+	AuthOAuth2 = "oauth2"
+	AuthNone   = "none"
+)
+
 type Http struct {
 	Name      string
 	AccessKey string
 	Url       string
 
+	//digest (default), basic, bearer, oauth2 or none. The credentials are found by the AccessKey,
+	//bearer: the password is the token, oauth2: the user is the client id and the password the client secret
+	Auth     string
+	TokenUrl string
+	Scopes   []string
+
 	PingRequest *ValidationRequest
+	//by default the ping fails for non 2xx status codes
+	PingAnyStatus bool
+
+	//response headers available as fields 'Header.<Name>'
+	ResponseHeaders []string
+
+	Tls *Tls
+	//forward proxy url, the proxy from environment (HTTP_PROXY, HTTPS_PROXY) is used if not set
+	Proxy string
+	//maximum redirects to follow, 0: default (10), -1: redirects are not followed
+	MaxRedirects int
 
 	PingTimeoutMillis  int
 	QueryTimeoutMillis int
 }
 
+//bodyFunctions are available in body templates, e.g. {{ now.Unix }}
+var bodyFunctions = template.FuncMap{
+	"now": time.Now,
+}
+
 type HttpService struct {
 	http         *Http
 	accessFinder as.AccessFinder
 
 	client    *http.Client
 	pingCheck *httpCheck
+	oauth2    *digest.OAuth2ClientCredentials
 
 	pingTimeout  time.Duration
 	queryTimeout time.Duration
+
+	lock sync.Mutex
 }
 
 func (o *HttpService) Name() string {
@@ -41,19 +82,81 @@ func (o *HttpService) Name() string {
 }
 
 func (o *HttpService) Init() (err error) {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	return o.init()
+}
+
+//init must be called with the lock
+func (o *HttpService) init() (err error) {
 	if o.client == nil {
-		o.client = digest.NewClient(true, o.queryTimeout)
-		o.pingCheck, err = o.newСheck(o.http.PingRequest)
-		if err != nil {
-			o.Close()
+		if o.client, err = o.newClient(); err != nil {
+			return
+		}
+		//shared by all checks of the service, because of the token cache
+		if strings.ToLower(o.http.Auth) == AuthOAuth2 {
+			if o.oauth2, err = o.newOAuth2(); err != nil {
+				o.close()
+				return
+			}
+		}
+		if o.http.PingRequest != nil {
+			o.pingCheck, err = o.newСheck(o.http.PingRequest)
+		} else {
+			o.pingCheck, err = o.newСheck(&ValidationRequest{})
+		}
+		if err == nil {
+			o.pingCheck.successOnly = !o.http.PingAnyStatus
+		} else {
+			o.close()
+		}
+	}
+	return
+}
+
+func (o *HttpService) newClient() (ret *http.Client, err error) {
+	var tlsConfig *tls.Config
+	if o.http.Tls != nil {
+		if tlsConfig, err = o.http.Tls.Config(o.accessFinder); err != nil {
+			err = errors.New(fmt.Sprintf("Invalid TLS configuration of %v: %v", o.Name(), err))
+			return
+		}
+	}
+	var proxy *url.URL
+	if len(o.http.Proxy) > 0 {
+		if proxy, err = url.Parse(o.http.Proxy); err != nil {
+			err = errors.New(fmt.Sprintf("Invalid proxy of %v: %v", o.Name(), err))
+			return
+		}
+	}
+
+	ret = digest.NewClientTls(tlsConfig, proxy, o.queryTimeout)
+
+	if maxRedirects := o.http.MaxRedirects; maxRedirects < 0 {
+		ret.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		}
+	} else if maxRedirects > 0 {
+		ret.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+			if len(via) > maxRedirects {
+				return errors.New(fmt.Sprintf("Stopped after %v redirects", maxRedirects))
+			}
+			return nil
 		}
 	}
 	return
 }
 
 func (o *HttpService) Close() {
+	o.lock.Lock()
+	o.close()
+	o.lock.Unlock()
+}
+
+func (o *HttpService) close() {
 	o.client = nil
 	o.pingCheck = nil
+	o.oauth2 = nil
 }
 
 func (o *HttpService) Ping() error {
@@ -82,12 +185,15 @@ func (o *HttpService) query(req *digest.Request) (ret []byte, err error) {
 	return
 }
 
-func (o *HttpService) queryToWriter(req *digest.Request, pattern *regexp.Regexp, writer eio.MapWriter) (err error) {
+func (o *HttpService) queryToWriter(req *digest.Request, pattern *regexp.Regexp, jsonPath *JsonPath,
+	successOnly bool, writer eio.MapWriter) (err error) {
 	if err = o.Init(); err != nil {
 		return
 	}
+	timings := &httpTimings{start: time.Now()}
 	var resp *http.Response
-	if resp, err = req.Execute(o.client); err != nil {
+	if resp, err = req.ExecuteContext(httptrace.WithClientTrace(context.Background(), timings.trace()),
+		o.client); err != nil {
 		return
 	}
 	defer resp.Body.Close()
@@ -96,9 +202,21 @@ func (o *HttpService) queryToWriter(req *digest.Request, pattern *regexp.Regexp,
 	if data, err = ioutil.ReadAll(resp.Body); err != nil {
 		return
 	}
+	fields := o.responseFields(resp, data, timings)
+
+	if successOnly && (resp.StatusCode < 200 || resp.StatusCode > 299) {
+		err = errors.New(fmt.Sprintf("Request %v %v failed with status '%v'", req.Method, req.Uri, resp.Status))
+		return
+	}
 
 	//Log.Debug(string(Data))
-	if pattern != nil {
+	var entries []map[string]interface{}
+	if jsonPath != nil {
+		if entries, err = jsonPath.Rows(bytes.NewReader(data)); err != nil {
+			err = errors.New(fmt.Sprintf("Can't parse the json response of %v because of %v", req.Uri, err))
+			return
+		}
+	} else if pattern != nil {
 		matches := pattern.FindAllSubmatch(data, -1)
 		for _, match := range matches {
 			entry := make(map[string]interface{})
@@ -107,16 +225,112 @@ func (o *HttpService) queryToWriter(req *digest.Request, pattern *regexp.Regexp,
 					entry[name] = match[i]
 				}
 			}
-			writer.WriteMap(entry)
+			entries = append(entries, entry)
 		}
 	} else {
 		entry := make(map[string]interface{})
 		entry["data"] = string(data)
-		writer.WriteMap(entry)
+		entries = append(entries, entry)
+	}
+
+	for _, entry := range entries {
+		for k, v := range fields {
+			if _, ok := entry[k]; !ok {
+				entry[k] = v
+			}
+		}
+		if err = writer.WriteMap(entry); err != nil {
+			break
+		}
+	}
+	return
+}
+
+//responseFields are added to every row: StatusCode, ContentLength, Header.<Name> and the timings in millis
+func (o *HttpService) responseFields(resp *http.Response, data []byte, timings *httpTimings) (
+	ret map[string]interface{}) {
+
+	ret = timings.fields(time.Now())
+	ret["StatusCode"] = resp.StatusCode
+	ret["ContentLength"] = len(data)
+	for _, header := range o.http.ResponseHeaders {
+		ret["Header."+header] = resp.Header.Get(header)
 	}
 	return
 }
 
+//httpTimings of the last attempt, e.g. of the retry after a digest challenge, the total time covers all attempts.
+//The trace callbacks may run concurrently, e.g. ConnectStart and ConnectDone of parallel dials.
+type httpTimings struct {
+	lock    sync.Mutex
+	start   time.Time
+	attempt httpAttempt
+}
+
+type httpAttempt struct {
+	start        time.Time
+	dnsStart     time.Time
+	dnsDone      time.Time
+	connectStart time.Time
+	connectDone  time.Time
+	tlsStart     time.Time
+	tlsDone      time.Time
+	firstByte    time.Time
+}
+
+func (o *httpTimings) trace() *httptrace.ClientTrace {
+	return &httptrace.ClientTrace{
+		GetConn: func(string) {
+			o.lock.Lock()
+			o.attempt = httpAttempt{start: time.Now()}
+			o.lock.Unlock()
+		},
+		DNSStart:     func(httptrace.DNSStartInfo) { o.set(&o.attempt.dnsStart, false) },
+		DNSDone:      func(httptrace.DNSDoneInfo) { o.set(&o.attempt.dnsDone, false) },
+		ConnectStart: func(string, string) { o.set(&o.attempt.connectStart, true) },
+		ConnectDone: func(network string, addr string, err error) {
+			if err == nil {
+				o.set(&o.attempt.connectDone, true)
+			}
+		},
+		TLSHandshakeStart:    func() { o.set(&o.attempt.tlsStart, false) },
+		TLSHandshakeDone:     func(tls.ConnectionState, error) { o.set(&o.attempt.tlsDone, false) },
+		GotFirstResponseByte: func() { o.set(&o.attempt.firstByte, false) },
+	}
+}
+
+//set the time of the current attempt, onlyFirst keeps the first time, e.g. of the first of parallel dials
+func (o *httpTimings) set(field *time.Time, onlyFirst bool) {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	if !onlyFirst || field.IsZero() {
+		*field = time.Now()
+	}
+}
+
+func (o *httpTimings) fields(done time.Time) map[string]interface{} {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	attempt := o.attempt
+	if attempt.start.IsZero() {
+		attempt.start = o.start
+	}
+	return map[string]interface{}{
+		"DnsMillis":       millisBetween(attempt.dnsStart, attempt.dnsDone),
+		"ConnectMillis":   millisBetween(attempt.connectStart, attempt.connectDone),
+		"TlsMillis":       millisBetween(attempt.tlsStart, attempt.tlsDone),
+		"FirstByteMillis": millisBetween(attempt.start, attempt.firstByte),
+		"TotalMillis":     millisBetween(o.start, done),
+	}
+}
+
+func millisBetween(start time.Time, end time.Time) float64 {
+	if start.IsZero() || end.IsZero() {
+		return 0
+	}
+	return float64(end.Sub(start)) / float64(time.Millisecond)
+}
+
 func body(resp *http.Response) string {
 	body, _ := ioutil.ReadAll(resp.Body)
 	ret := fmt.Sprintf("%v", body)
@@ -128,12 +342,18 @@ func (o *HttpService) NewExecutor(req *CommandRequest) (ret Executor, err error)
 }
 
 func (o *HttpService) NewСheck(req *ValidationRequest) (ret Check, err error) {
-	return o.newСheck(req)
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	if err = o.init(); err == nil {
+		ret, err = o.newСheck(req)
+	}
+	return
 }
 
 func (o *HttpService) newСheck(req *ValidationRequest) (ret *httpCheck, err error) {
 	var access as.Access
-	if access, err = o.accessFinder.FindAccess(o.http.AccessKey); err != nil {
+	var auth digest.Authenticator
+	if access, auth, err = o.findAuth(); err != nil {
 		return
 	}
 
@@ -142,15 +362,102 @@ func (o *HttpService) newСheck(req *ValidationRequest) (ret *httpCheck, err err
 		return
 	}
 
+	var aggr *aggregation
+	if aggr, err = compileAggr(req.AggrExpr); err != nil {
+		return
+	}
+
 	var pattern *regexp.Regexp
 	if pattern, err = compileRegExpr(req.RegExpr); err != nil {
 		return
 	}
 
-	dReq := digest.NewRequest(access.User, access.Password, "GET", o.http.Url+req.Query, "")
+	var jsonPath *JsonPath
+	if jsonPath, err = compileJsonPath(req.JsonPath); err != nil {
+		return
+	}
+
+	var body *template.Template
+	if len(req.Body) > 0 {
+		if body, err = template.New("body").Funcs(bodyFunctions).Parse(req.Body); err != nil {
+			return
+		}
+	}
+
+	method := http.MethodGet
+	if len(req.Method) > 0 {
+		method = strings.ToUpper(req.Method)
+	}
+
+	dReq := digest.NewRequest(access.User, access.Password, method, o.buildUrl(req.Query, req.QueryParams), "")
+	dReq.Authenticator = auth
+	dReq.ContentType = req.ContentType
+	if len(req.Headers) > 0 {
+		dReq.Header = make(http.Header)
+		for key, value := range req.Headers {
+			dReq.Header.Set(key, value)
+		}
+	}
+
 	ret = &httpCheck{
-		info:    req.CheckKey(o.Name()), req: &dReq,
-		pattern: pattern, service: o, eval: eval, all: req.All}
+		info:    req.CheckKey(o.Name()), req: &dReq, query: req.Query, queryParams: req.QueryParams, body: body,
+		pattern: pattern, jsonPath: jsonPath, service: o, eval: eval, all: req.All, aggr: aggr}
+	return
+}
+
+func (o *HttpService) buildUrl(query string, queryParams map[string]string) (ret string) {
+	ret = o.http.Url + query
+	if len(queryParams) > 0 {
+		params := url.Values{}
+		for key, value := range queryParams {
+			params.Set(key, value)
+		}
+		if strings.Contains(ret, "?") {
+			ret = ret + "&" + params.Encode()
+		} else {
+			ret = ret + "?" + params.Encode()
+		}
+	}
+	return
+}
+
+//findAuth must be called with the lock, after the init
+func (o *HttpService) findAuth() (access as.Access, ret digest.Authenticator, err error) {
+	authType := strings.ToLower(o.http.Auth)
+	if authType == AuthNone {
+		ret = digest.NoAuth{}
+		return
+	}
+
+	if access, err = o.accessFinder.FindAccess(o.http.AccessKey); err != nil {
+		return
+	}
+
+	switch authType {
+	case "", AuthDigest:
+		ret = digest.DigestAuth{}
+	case AuthBasic:
+		ret = &digest.BasicAuth{Username: access.User, Password: access.Password}
+	case AuthBearer:
+		ret = &digest.BearerAuth{Token: access.Password}
+	case AuthOAuth2:
+		ret = o.oauth2
+	default:
+		err = errors.New(fmt.Sprintf("The auth '%v' of %v is not supported", o.http.Auth, o.Name()))
+	}
+	return
+}
+
+func (o *HttpService) newOAuth2() (ret *digest.OAuth2ClientCredentials, err error) {
+	var access as.Access
+	if access, err = o.accessFinder.FindAccess(o.http.AccessKey); err != nil {
+		return
+	}
+	var client *http.Client
+	if client, err = o.newClient(); err == nil {
+		ret = &digest.OAuth2ClientCredentials{TokenUrl: o.http.TokenUrl, Scopes: o.http.Scopes,
+			ClientId: access.User, ClientSecret: access.Password, Client: client}
+	}
 	return
 }
 
@@ -162,12 +469,21 @@ func (o *HttpService) NewExporter(req *ExportRequest) (ret Exporter, err error)
 //buildCheck
 
 type httpCheck struct {
-	info    string
-	req     *digest.Request
-	all     bool
-	eval    *govaluate.EvaluableExpression
-	pattern *regexp.Regexp
-	service *HttpService
+	info     string
+	req      *digest.Request
+	all      bool
+	eval     *govaluate.EvaluableExpression
+	aggr     *aggregation
+	pattern  *regexp.Regexp
+	jsonPath *JsonPath
+	service  *HttpService
+
+	//the url and body are prepared for every request, because of the time placeholders
+	query       string
+	queryParams map[string]string
+	body        *template.Template
+
+	successOnly bool
 }
 
 func (o *httpCheck) Info() string {
@@ -175,12 +491,27 @@ func (o *httpCheck) Info() string {
 }
 
 func (o *httpCheck) Validate() error {
-	return validate(o, o.eval, o.all)
+	return validate(o, o.eval, o.all, o.aggr)
 }
 
 func (o *httpCheck) Query() (ret QueryResults, err error) {
+	//copy of the request, because checks are queried concurrently
+	req := *o.req
+	queryParams := make(map[string]string, len(o.queryParams))
+	for key, value := range o.queryParams {
+		queryParams[key] = replaceTimePlaceHolders(value, LayoutRfc3339, nil)
+	}
+	req.Uri = o.service.buildUrl(replaceTimePlaceHolders(o.query, LayoutRfc3339, url.QueryEscape), queryParams)
+	if o.body != nil {
+		var body bytes.Buffer
+		if err = o.body.Execute(&body, nil); err != nil {
+			return
+		}
+		req.Body = replaceTimePlaceHolders(body.String(), LayoutRfc3339, nil)
+	}
+
 	writer := NewQueryResultMapWriter()
-	if err = o.service.queryToWriter(o.req, o.pattern, writer); err == nil {
+	if err = o.service.queryToWriter(&req, o.pattern, o.jsonPath, o.successOnly, writer); err == nil {
 		ret = writer.Data
 	}
 	return
@@ -207,8 +538,8 @@ func (o *httpExporter) Export(params map[string]string) (err error) {
 	if out, err = o.req.CreateOut(params); err != nil {
 		return
 	}
-	defer out.Close()
+	defer closeExportOut(out, &err)
 
-	err = o.service.queryToWriter(o.httpReq, o.pattern, &eio.WriteCloserMapWriter{Convert: o.req.Convert, Out: out})
+	err = o.service.queryToWriter(o.httpReq, o.pattern, nil, false, &eio.WriteCloserMapWriter{Convert: o.req.Convert, Out: out})
 	return
 }
@@ -0,0 +1,243 @@
+package core
+
+import (
+	"encoding/pem"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"regexp"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestHttpServiceJsonPath(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, `{"checks": [{"status": "UP", "db": {"latencyMs": 12}}, {"status": "UP", "db": {"latencyMs": 150}}]}`)
+	}))
+	defer server.Close()
+
+	service := &HttpService{http: &Http{Name: "http", Url: server.URL, PingRequest: &ValidationRequest{}},
+		accessFinder: mapAccessFinder{}}
+
+	check, err := service.NewСheck(&ValidationRequest{Query: "/health", JsonPath: "$.checks[*]",
+		EvalExpr: `status == "UP" && db.latencyMs < 200`, All: true})
+	AssertEqual(t, err, nil, ErrorMessageBuilder)
+
+	data, err := check.Query()
+	AssertEqual(t, err, nil, ErrorMessageBuilder)
+	AssertEqual(t, len(data), 2, nil)
+	AssertEqual(t, check.Validate(), nil, ErrorMessageBuilder)
+}
+
+func TestHttpServiceStatus(t *testing.T) {
+	status := http.StatusInternalServerError
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Version", "1.2")
+		w.WriteHeader(status)
+		io.WriteString(w, "UP")
+	}))
+	defer server.Close()
+
+	service := &HttpService{http: &Http{Name: "http", Url: server.URL, ResponseHeaders: []string{"X-Version"}},
+		accessFinder: mapAccessFinder{}}
+	AssertEqual(t, service.Ping() != nil, true, nil)
+
+	check, err := service.NewСheck(&ValidationRequest{
+		EvalExpr: `StatusCode == 500 && [Header.X-Version] == "1.2" && TotalMillis >= 0`, All: true})
+	AssertEqual(t, err, nil, ErrorMessageBuilder)
+	AssertEqual(t, check.Validate(), nil, ErrorMessageBuilder)
+
+	status = http.StatusOK
+	AssertEqual(t, service.Ping(), nil, ErrorMessageBuilder)
+}
+
+func TestHttpServiceOAuth2(t *testing.T) {
+	tokenRequests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/token" {
+			if clientId, clientSecret, _ := r.BasicAuth(); clientId != "eye" || clientSecret != "secret" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			tokenRequests++
+			io.WriteString(w, `{"access_token": "token1", "token_type": "bearer", "expires_in": 3600}`)
+		} else if r.Header.Get("Authorization") != "Bearer token1" {
+			w.WriteHeader(http.StatusUnauthorized)
+		}
+	}))
+	defer server.Close()
+
+	service := &HttpService{http: &Http{Name: "http", Url: server.URL, AccessKey: "http",
+		Auth: AuthOAuth2, TokenUrl: server.URL + "/token"},
+		accessFinder: mapAccessFinder{"http": {User: "eye", Password: "secret"}}}
+	AssertEqual(t, service.Ping(), nil, ErrorMessageBuilder)
+	AssertEqual(t, service.Ping(), nil, ErrorMessageBuilder)
+	AssertEqual(t, tokenRequests, 1, nil)
+
+	//checks share the token of the service, also if they are created concurrently to the service init
+	service.Close()
+	var wg sync.WaitGroup
+	errs := make(chan error, 8)
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			check, err := service.NewСheck(&ValidationRequest{})
+			if err == nil {
+				err = check.Validate()
+			}
+			errs <- err
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		AssertEqual(t, err, nil, ErrorMessageBuilder)
+	}
+	AssertEqual(t, tokenRequests, 2, nil)
+}
+
+func TestHttpServiceTls(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	caFile, _ := ioutil.TempFile("", "eye_ca")
+	defer os.Remove(caFile.Name())
+	pem.Encode(caFile, &pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	caFile.Close()
+
+	service := &HttpService{http: &Http{Name: "http", Url: server.URL}, accessFinder: mapAccessFinder{}}
+	AssertEqual(t, service.Ping() != nil, true, nil)
+
+	service = &HttpService{http: &Http{Name: "http", Url: server.URL, Tls: &Tls{CaFile: caFile.Name()}},
+		accessFinder: mapAccessFinder{}}
+	AssertEqual(t, service.Ping(), nil, ErrorMessageBuilder)
+
+	service = &HttpService{http: &Http{Name: "http", Url: server.URL, Tls: &Tls{InsecureSkipVerify: true}},
+		accessFinder: mapAccessFinder{}}
+	AssertEqual(t, service.Ping(), nil, ErrorMessageBuilder)
+}
+
+func TestHttpServiceRequest(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/moved" {
+			http.Redirect(w, r, "/rpc", http.StatusFound)
+			return
+		}
+		body, _ := ioutil.ReadAll(r.Body)
+		if r.Method == http.MethodPost && r.Header.Get("X-Api") == "v1" && r.URL.Query().Get("debug") == "true" &&
+			r.Header.Get("Content-Type") == "application/json" && string(body) == `{"method": "status"}` {
+			io.WriteString(w, `{"result": "ok"}`)
+		} else {
+			w.WriteHeader(http.StatusBadRequest)
+		}
+	}))
+	defer server.Close()
+
+	service := &HttpService{http: &Http{Name: "http", Url: server.URL, MaxRedirects: -1}, accessFinder: mapAccessFinder{}}
+	check, err := service.NewСheck(&ValidationRequest{Query: "/rpc", Method: "post",
+		Headers: map[string]string{"X-Api": "v1"}, QueryParams: map[string]string{"debug": "true"},
+		Body: `{"method": "{{ "status" }}"}`, ContentType: "application/json",
+		JsonPath: "$", EvalExpr: `StatusCode == 200 && result == "ok"`, All: true})
+	AssertEqual(t, err, nil, ErrorMessageBuilder)
+	AssertEqual(t, check.Validate(), nil, ErrorMessageBuilder)
+
+	check, err = service.NewСheck(&ValidationRequest{Query: "/moved", EvalExpr: "StatusCode == 302", All: true})
+	AssertEqual(t, err, nil, ErrorMessageBuilder)
+	AssertEqual(t, check.Validate(), nil, ErrorMessageBuilder)
+}
+
+func TestHttpServiceTimingsOfRetry(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") == "" {
+			time.Sleep(200 * time.Millisecond)
+			w.Header().Set("WWW-Authenticate", `Digest realm="eye", nonce="abc", qop="auth", algorithm=SHA-256`)
+			w.WriteHeader(http.StatusUnauthorized)
+		}
+	}))
+	defer server.Close()
+
+	//the first byte is measured for the retry, the total time covers the challenge
+	service := &HttpService{http: &Http{Name: "http", Url: server.URL, AccessKey: "http"},
+		accessFinder: mapAccessFinder{"http": {User: "eye", Password: "secret"}}}
+	check, err := service.NewСheck(&ValidationRequest{
+		EvalExpr: "StatusCode == 200 && FirstByteMillis < 150 && TotalMillis >= 200", All: true})
+	AssertEqual(t, err, nil, ErrorMessageBuilder)
+	AssertEqual(t, check.Validate(), nil, ErrorMessageBuilder)
+}
+
+func TestHttpServiceConcurrentDigest(t *testing.T) {
+	var lock sync.Mutex
+	ncs := make(map[string]bool)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authorization := r.Header.Get("Authorization")
+		if authorization == "" {
+			w.Header().Set("WWW-Authenticate", `Digest realm="eye", nonce="abc", qop="auth", algorithm=SHA-256`)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		nc := regexp.MustCompile(`nc=(\w+)`).FindStringSubmatch(authorization)[1]
+		lock.Lock()
+		defer lock.Unlock()
+		if ncs[nc] {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		ncs[nc] = true
+		body, _ := ioutil.ReadAll(r.Body)
+		w.Write(body)
+	}))
+	defer server.Close()
+
+	service := &HttpService{http: &Http{Name: "http", Url: server.URL, AccessKey: "http"},
+		accessFinder: mapAccessFinder{"http": {User: "eye", Password: "secret"}}}
+	check, err := service.NewСheck(&ValidationRequest{Method: "POST", Body: `{{ now.UnixNano }}`, RegExpr: `\d+`,
+		EvalExpr: "StatusCode == 200", All: true})
+	AssertEqual(t, err, nil, ErrorMessageBuilder)
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 100)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 10; j++ {
+				if err := check.Validate(); err != nil {
+					errs <- err
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		t.Error(err)
+	}
+}
+
+func TestHttpServiceTimePlaceHolders(t *testing.T) {
+	var from, to string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		from = r.URL.Query().Get("from")
+		to = r.URL.Query().Get("to")
+	}))
+	defer server.Close()
+
+	service := &HttpService{http: &Http{Name: "http", Url: server.URL, Auth: AuthNone}, accessFinder: mapAccessFinder{}}
+	check, err := service.NewСheck(&ValidationRequest{Query: "/logs?to=@@NOW@@",
+		QueryParams: map[string]string{"from": "@@NOW-1h|unix@@"}})
+	AssertEqual(t, err, nil, ErrorMessageBuilder)
+
+	_, err = check.Query()
+	AssertEqual(t, err, nil, ErrorMessageBuilder)
+	fromUnix, _ := strconv.ParseInt(from, 10, 64)
+	AssertEqual(t, time.Now().Unix()-fromUnix >= 3600, true, nil)
+	_, err = time.Parse(time.RFC3339, to)
+	AssertEqual(t, err, nil, ErrorMessageBuilder)
+}
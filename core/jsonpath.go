@@ -0,0 +1,192 @@
+package core
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// JsonPath is a compiled selector of the JSONPath subset: $, .name, ['name'], [n], [*], .* and ..name
+type JsonPath struct {
+	expr  string
+	steps []*jsonPathStep
+}
+
+type jsonPathStep struct {
+	name      string
+	index     int
+	wildcard  bool
+	recursive bool
+	isIndex   bool
+}
+
+func compileJsonPath(expr string) (ret *JsonPath, err error) {
+	if len(expr) == 0 {
+		return
+	}
+	path := strings.TrimSpace(expr)
+	path = strings.TrimPrefix(path, "$")
+
+	ret = &JsonPath{expr: expr}
+	for len(path) > 0 && err == nil {
+		step := &jsonPathStep{}
+		switch {
+		case strings.HasPrefix(path, ".."):
+			step.recursive = true
+			path, err = parseJsonPathName(path[2:], step)
+		case strings.HasPrefix(path, "."):
+			path, err = parseJsonPathName(path[1:], step)
+		case strings.HasPrefix(path, "["):
+			path, err = parseJsonPathBracket(path, step)
+		default:
+			err = errors.New(fmt.Sprintf("Unexpected '%v' in the json path '%v'", path, expr))
+		}
+		ret.steps = append(ret.steps, step)
+	}
+	if err != nil {
+		ret = nil
+	}
+	return
+}
+
+func parseJsonPathName(path string, step *jsonPathStep) (rest string, err error) {
+	if strings.HasPrefix(path, "[") {
+		return parseJsonPathBracket(path, step)
+	}
+	end := strings.IndexAny(path, ".[")
+	if end < 0 {
+		end = len(path)
+	}
+	if end == 0 {
+		err = errors.New(fmt.Sprintf("Missing name in the json path at '%v'", path))
+		return
+	}
+	if name := path[:end]; name == "*" {
+		step.wildcard = true
+	} else {
+		step.name = name
+	}
+	rest = path[end:]
+	return
+}
+
+func parseJsonPathBracket(path string, step *jsonPathStep) (rest string, err error) {
+	end := strings.Index(path, "]")
+	if end < 0 {
+		err = errors.New(fmt.Sprintf("Missing ']' in the json path at '%v'", path))
+		return
+	}
+	content := strings.TrimSpace(path[1:end])
+	rest = path[end+1:]
+
+	if content == "*" {
+		step.wildcard = true
+	} else if unquoted, unquoteErr := strconv.Unquote(strings.Replace(content, "'", "\"", -1)); unquoteErr == nil {
+		step.name = unquoted
+	} else if step.index, err = strconv.Atoi(content); err == nil {
+		step.isIndex = true
+	} else {
+		err = errors.New(fmt.Sprintf("Invalid selector '[%v]' in the json path", content))
+	}
+	return
+}
+
+func (o *JsonPath) Select(data interface{}) (ret []interface{}) {
+	ret = []interface{}{data}
+	for _, step := range o.steps {
+		var next []interface{}
+		for _, node := range ret {
+			if step.recursive {
+				next = step.selectRecursive(node, next)
+			} else {
+				next = step.selectNode(node, next)
+			}
+		}
+		ret = next
+	}
+	return
+}
+
+func (o *jsonPathStep) selectNode(node interface{}, found []interface{}) []interface{} {
+	switch value := node.(type) {
+	case map[string]interface{}:
+		if o.wildcard {
+			for _, child := range value {
+				found = append(found, child)
+			}
+		} else if child, ok := value[o.name]; ok && !o.isIndex {
+			found = append(found, child)
+		}
+	case []interface{}:
+		if o.wildcard {
+			found = append(found, value...)
+		} else if o.isIndex {
+			index := o.index
+			if index < 0 {
+				index = len(value) + index
+			}
+			if index >= 0 && index < len(value) {
+				found = append(found, value[index])
+			}
+		}
+	}
+	return found
+}
+
+func (o *jsonPathStep) selectRecursive(node interface{}, found []interface{}) []interface{} {
+	found = o.selectNode(node, found)
+	switch value := node.(type) {
+	case map[string]interface{}:
+		for _, child := range value {
+			found = o.selectRecursive(child, found)
+		}
+	case []interface{}:
+		for _, child := range value {
+			found = o.selectRecursive(child, found)
+		}
+	}
+	return found
+}
+
+// Rows parses the json data and maps every selected node to a row, a selected array to a row per element.
+// Nested objects are flattened, e.g. 'db.latencyMs', which can be used in eval expressions as they are.
+func (o *JsonPath) Rows(reader io.Reader) (ret []map[string]interface{}, err error) {
+	var data interface{}
+	if err = json.NewDecoder(reader).Decode(&data); err != nil {
+		return
+	}
+
+	for _, node := range o.Select(data) {
+		if items, ok := node.([]interface{}); ok {
+			for _, item := range items {
+				ret = append(ret, jsonRow(item))
+			}
+		} else {
+			ret = append(ret, jsonRow(node))
+		}
+	}
+	return
+}
+
+func jsonRow(node interface{}) (ret map[string]interface{}) {
+	ret = make(map[string]interface{})
+	if object, ok := node.(map[string]interface{}); ok {
+		flattenJson("", object, ret)
+	} else {
+		ret["value"] = node
+	}
+	return
+}
+
+func flattenJson(prefix string, object map[string]interface{}, row map[string]interface{}) {
+	for key, value := range object {
+		if child, ok := value.(map[string]interface{}); ok {
+			flattenJson(prefix+key+".", child, row)
+		} else {
+			row[prefix+key] = value
+		}
+	}
+}
@@ -1,23 +1,69 @@
 package core
 
-import "gopkg.in/Knetic/govaluate.v2"
+import (
+	"fmt"
+	"gopkg.in/Knetic/govaluate.v2"
+)
 
 type MultiCheck struct {
 	info        string
 	queries     []Query
 	eval        *govaluate.EvaluableExpression
+	aggr        *aggregation
 	all         bool
 	onlyRunning bool
+	joinKeys    []string
+	equalFields []string
+	tolerances  map[string]*tolerance
+	//names of the services of the queries
+	services []string
 }
 
 func (o *MultiCheck) Validate() (err error) {
 	var data QueryResults
-	if data, err = o.checksData(); err == nil {
-		err = validateData(data, o.eval, o.all, o.info)
+	var services []string
+	if data, services, err = o.checksData(); err != nil {
+		return
+	}
+	if len(o.equalFields) > 0 {
+		var report *DiffReport
+		if report, err = buildDiffReport(o.info, services, o.joinKeys, o.equalFields, o.tolerances, data); err != nil {
+			return
+		}
+		if !report.Equal() {
+			err = &DiffError{Report: report}
+			return
+		}
+	}
+	if o.eval != nil || o.aggr != nil || len(o.equalFields) == 0 {
+		err = validateData(data, o.eval, o.all, o.aggr, o.info)
+	}
+	return
+}
+
+//Diff compares the equal fields of the services, or all fields if no equal fields are defined
+func (o *MultiCheck) Diff() (ret *DiffReport, err error) {
+	var data QueryResults
+	var services []string
+	if data, services, err = o.checksData(); err == nil {
+		ret, err = buildDiffReport(o.info, services, o.joinKeys, o.equalFields, o.tolerances, data)
 	}
 	return
 }
 
+//valuesEqual compares numbers by their value and others by their text, because services return different types
+func valuesEqual(a interface{}, b interface{}) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	if aNumber, err := toFloat(a); err == nil {
+		if bNumber, err := toFloat(b); err == nil {
+			return aNumber == bNumber
+		}
+	}
+	return toText(a) == toText(b)
+}
+
 func (o *MultiCheck) Query() (data QueryResults, err error) {
 	return
 }
@@ -26,23 +72,35 @@ func (o *MultiCheck) Info() string {
 	return o.info
 }
 
-func (o *MultiCheck) checksData() (ret QueryResults, err error) {
+func (o *MultiCheck) checksData() (ret QueryResults, services []string, err error) {
 	querysData := make([]QueryResults, 0)
-	for _, check := range o.queries {
+	for i, check := range o.queries {
 		data, queryErr := check.Query()
 		if queryErr == nil {
 			querysData = append(querysData, data)
+			services = append(services, o.serviceName(i))
 		} else if o.onlyRunning {
 			err = queryErr
 			break
 		}
 	}
 	if err == nil {
-		ret, err = ComposeQueryResults("_", querysData)
+		if len(o.joinKeys) > 0 {
+			ret, err = JoinQueryResults("_", o.joinKeys, querysData)
+		} else {
+			ret, err = ComposeQueryResults("_", querysData)
+		}
 	}
 	return
 }
 
+func (o *MultiCheck) serviceName(index int) string {
+	if index < len(o.services) {
+		return o.services[index]
+	}
+	return fmt.Sprintf("%v", index+1)
+}
+
 type MultiPing struct {
 	check     *PingCheck
 	validator func([]string) error
@@ -1,6 +1,8 @@
 package core
 
 import (
+	"bytes"
+	"strings"
 	"testing"
 	_ "github.com/go-sql-driver/mysql"
 	"github.com/eugeis/gee/as"
@@ -28,3 +30,114 @@ func TestMultiService(t *testing.T) {
 		AssertEqual(t, err, nil, ErrorMessageBuilder)
 	}
 }
+
+type staticQuery struct {
+	data QueryResults
+	err  error
+}
+
+func (o *staticQuery) Info() string {
+	return "static"
+}
+
+func (o *staticQuery) Query() (QueryResults, error) {
+	return o.data, o.err
+}
+
+func rows(items ...map[string]interface{}) (ret QueryResults) {
+	for _, item := range items {
+		ret = append(ret, &MapQueryResult{item})
+	}
+	return
+}
+
+func TestJoinQueryResults(t *testing.T) {
+	joined, err := JoinQueryResults("_", []string{"id"}, []QueryResults{
+		rows(map[string]interface{}{"id": 1, "name": "a"}, map[string]interface{}{"id": 2, "name": "b"}),
+		rows(map[string]interface{}{"id": "2", "name": "b"}, map[string]interface{}{"id": 3, "name": "c"}),
+	})
+	AssertEqual(t, err, nil, ErrorMessageBuilder)
+	AssertEqual(t, len(joined), 3, nil)
+
+	value, _ := joined[1].Get("name_2")
+	AssertEqual(t, value, "b", nil)
+	value, _ = joined[1].Get("id")
+	AssertEqual(t, value, 2, nil)
+	value, _ = joined[0].Get("Missing_2")
+	AssertEqual(t, value, true, nil)
+	value, _ = joined[0].Get("name_2")
+	AssertEqual(t, value, nil, nil)
+	value, _ = joined[2].Get("Missing_2")
+	AssertEqual(t, value, false, nil)
+}
+
+func TestMultiCheckJoin(t *testing.T) {
+	service1 := &staticQuery{data: rows(map[string]interface{}{"table": "users", "count": int64(10)},
+		map[string]interface{}{"table": "orders", "count": int64(20)})}
+	service2 := &staticQuery{data: rows(map[string]interface{}{"table": "orders", "count": "20"},
+		map[string]interface{}{"table": "users", "count": []byte("10")})}
+
+	check := &MultiCheck{info: "test", queries: []Query{service1, service2}, all: true,
+		joinKeys: []string{"table"}, equalFields: []string{"count"}}
+	AssertEqual(t, check.Validate(), nil, ErrorMessageBuilder)
+
+	check.eval, _ = compileEval("!Missing_1 && !Missing_2 && count_1 == 10")
+	AssertEqual(t, check.Validate() != nil, true, nil)
+
+	service2.data = append(service2.data, &MapQueryResult{map[string]interface{}{"table": "items", "count": 1}})
+	check.eval = nil
+	AssertEqual(t, check.Validate() != nil, true, nil)
+}
+
+func TestMultiCheckDiff(t *testing.T) {
+	service1 := &staticQuery{data: rows(map[string]interface{}{"table": "users", "count": 10, "engine": "InnoDB"},
+		map[string]interface{}{"table": "orders", "count": 20, "engine": "InnoDB"})}
+	service2 := &staticQuery{data: rows(map[string]interface{}{"table": "users", "count": "11", "engine": "InnoDB"},
+		map[string]interface{}{"table": "items", "count": 1, "engine": "InnoDB"})}
+
+	check := &MultiCheck{info: "test", queries: []Query{service1, service2}, services: []string{"db1", "db2"},
+		joinKeys: []string{"table"}, equalFields: []string{"count"}}
+
+	err := check.Validate()
+	diffErr, ok := err.(*DiffError)
+	AssertEqual(t, ok, true, nil)
+	if !ok {
+		return
+	}
+	report := diffErr.Report
+	AssertEqual(t, len(report.Rows), 3, nil)
+	AssertEqual(t, report.Rows[0].Key["table"], "users", nil)
+	AssertEqual(t, len(report.Rows[0].Fields), 1, nil)
+	AssertEqual(t, report.Rows[0].Fields[0].Field, "count", nil)
+	AssertEqual(t, report.Rows[0].Fields[0].Values[1], "11", nil)
+	AssertEqual(t, strings.Join(report.Rows[1].Missing, ","), "db2", nil)
+	AssertEqual(t, strings.Join(report.Rows[2].Missing, ","), "db1", nil)
+	AssertEqual(t, strings.Contains(err.Error(), "table=users: 'count' differs (db1=10, db2=11)"), true, nil)
+
+	var csv bytes.Buffer
+	AssertEqual(t, report.WriteCsv(&csv), nil, ErrorMessageBuilder)
+	AssertEqual(t, csv.String(), "table,Field,db1,db2\nusers,count,10,11\norders,Missing,false,true\n"+
+		"items,Missing,true,false\n", nil)
+
+	var html bytes.Buffer
+	AssertEqual(t, report.WriteHtml(&html), nil, ErrorMessageBuilder)
+	AssertEqual(t, strings.Contains(html.String(), "<td>users</td><td>count</td><td>10</td><td>11</td>"), true, nil)
+}
+
+func TestMultiCheckDiffAllFields(t *testing.T) {
+	service1 := &staticQuery{data: rows(map[string]interface{}{"C1": 1, "C2": "a"})}
+	service2 := &staticQuery{data: rows(map[string]interface{}{"C1": 1, "C2": "b"})}
+
+	check := &MultiCheck{info: "test", queries: []Query{service1, service2}, services: []string{"db1", "db2"}}
+	report, err := check.Diff()
+	AssertEqual(t, err, nil, ErrorMessageBuilder)
+	AssertEqual(t, strings.Join(report.Keys, ","), DiffRowKey, nil)
+	AssertEqual(t, len(report.Rows), 1, nil)
+	AssertEqual(t, report.Rows[0].Key[DiffRowKey], 1, nil)
+	AssertEqual(t, report.Rows[0].Fields[0].Field, "C2", nil)
+	AssertEqual(t, report.Rows[0].Fields[0].Values[1], "b", nil)
+
+	service2.data = rows(map[string]interface{}{"C1": 1, "C2": "a"})
+	report, err = check.Diff()
+	AssertEqual(t, report.Equal(), true, nil)
+}
@@ -1,10 +1,17 @@
 package core
 
 import (
+	"bytes"
+	"crypto/tls"
 	"database/sql"
+	"encoding/base64"
 	"errors"
 	"fmt"
+	"github.com/go-sql-driver/mysql"
+	"net/url"
+	"sort"
 	"strings"
+	"sync"
 	"time"
 	"github.com/eugeis/gee/as"
 	"gopkg.in/Knetic/govaluate.v2"
@@ -13,8 +20,6 @@ import (
 	"github.com/eugeis/gee/eio"
 )
 
-var disallowedSqlKeywords = []string{" UNION ", " LIMIT ", ";"}
-
 type MySql struct {
 	Name      string `default:"mysql"`
 	AccessKey string `default:"mysql"`
@@ -26,8 +31,20 @@ type MySql struct {
 
 	PingTimeoutMillis  int
 	QueryTimeoutMillis int
+
+	//connection pool: default 5 open connections (-1 for unlimited), 2 idle connections (-1 for none)
+	//and unlimited lifetime
+	MaxOpenConns          int
+	MaxIdleConns          int
+	ConnMaxLifetimeMillis int
+
+	Tls *Tls
+	//additional DSN parameters, e.g. charset: utf8mb4
+	Params map[string]string
 }
 
+const defaultMaxOpenConns = 5
+
 type MySqlService struct {
 	mysql        *MySql
 	accessFinder as.AccessFinder
@@ -35,49 +52,42 @@ type MySqlService struct {
 	db           *sql.DB
 	pingTimeout  time.Duration
 	queryTimeout time.Duration
-}
 
-func (o *MySqlService) Name() string {
-	return o.mysql.Name
+	//prepared statements of queries with bound arguments
+	stmtsLock sync.Mutex
+	stmts     map[string]*cachedStmt
+	stmtsUsed uint64
 }
 
-func (o *MySqlService) validateQuery(query string) error {
-	var err error
-	queryLowCase := strings.ToUpper(query)
+//maximal count of cached prepared statements per service
+const maxCachedStatements = 100
 
-	for _, keyword := range disallowedSqlKeywords {
-		if strings.Contains(queryLowCase, keyword) {
-			err = errors.New(fmt.Sprintf("'%v' is disallowed for Query", keyword))
-			break
-		}
-	}
-	if len(queryLowCase) == 0 {
-		err = errors.New("Query is empOnly SELECT/SHOW queries allowed")
-	}
-	if !(strings.HasPrefix(queryLowCase, "SELECT ") || strings.HasPrefix(queryLowCase, "SHOW ")) {
-		err = errors.New("Only SELECT/SHOW queries allowed")
-	}
-	return err
+//cachedStmt is closed, when it is evicted from the cache and no query uses it anymore
+type cachedStmt struct {
+	query   string
+	stmt    *sql.Stmt
+	users   int
+	used    uint64
+	evicted bool
 }
 
-func (o *MySqlService) limitQuery(query string) string {
-	queryLowCase := strings.ToUpper(query)
-	if strings.HasPrefix(queryLowCase, "SELECT ") {
-		return query + " LIMIT 5"
-	} else {
-		return query
-	}
+func (o *MySqlService) Name() string {
+	return o.mysql.Name
 }
 
 func (o *MySqlService) Init() (err error) {
 	if o.db == nil {
 		var access as.Access
 		if access, err = o.accessFinder.FindAccess(o.mysql.AccessKey); err == nil {
-			dataSource := fmt.Sprintf("%v:%s@tcp(%v:%d)/%v", access.User, access.Password,
-				o.mysql.Host, o.mysql.Port, o.mysql.Database)
+			var dataSource string
+			if dataSource, err = o.dataSource(access); err != nil {
+				return
+			}
 			o.db, err = sql.Open("mysql", dataSource)
 
 			if err == nil {
+				o.configurePool()
+
 				if o.mysql.PingTimeoutMillis > 0 {
 					o.pingTimeout = time.Duration(o.mysql.PingTimeoutMillis) * time.Millisecond
 					Log.Debug("Ping timeout for %v is %v", o.Name(), o.pingTimeout)
@@ -99,7 +109,109 @@ func (o *MySqlService) Init() (err error) {
 	return
 }
 
+//mysqlRawParams are the DSN params, which values are used by the driver as they are, e.g. charset: utf8mb4,utf8;
+//other values, e.g. loc, tls or system variables, are unescaped by the driver
+var mysqlRawParams = map[string]bool{
+	"allowAllFiles": true, "allowCleartextPasswords": true, "allowFallbackToPlaintext": true,
+	"allowNativePasswords": true, "allowOldPasswords": true, "charset": true, "checkConnLiveness": true,
+	"clientFoundRows": true, "collation": true, "columnsWithAlias": true, "compress": true,
+	"interpolateParams": true, "maxAllowedPacket": true, "multiStatements": true, "parseTime": true,
+	"readTimeout": true, "rejectReadOnly": true, "strict": true, "timeout": true, "writeTimeout": true,
+}
+
+//dataSource builds the DSN with the additional params and the registered TLS config
+func (o *MySqlService) dataSource(access as.Access) (ret string, err error) {
+	params := make(map[string]string, len(o.mysql.Params)+1)
+	for key, value := range o.mysql.Params {
+		params[key] = value
+	}
+	if o.mysql.Tls != nil {
+		var tlsConfig *tls.Config
+		if tlsConfig, err = o.mysql.Tls.Config(o.accessFinder); err != nil {
+			return
+		}
+		tlsName := "eye_" + o.Name()
+		if err = mysql.RegisterTLSConfig(tlsName, tlsConfig); err != nil {
+			return
+		}
+		params["tls"] = tlsName
+	}
+
+	ret = fmt.Sprintf("%v:%s@tcp(%v:%d)/%v", access.User, access.Password,
+		o.mysql.Host, o.mysql.Port, o.mysql.Database)
+	if len(params) > 0 {
+		ret += "?" + encodeDsnParams(params)
+	}
+	return
+}
+
+//encodeDsnParams joins the params sorted by key, only values unescaped by the driver are escaped
+func encodeDsnParams(params map[string]string) string {
+	keys := make([]string, 0, len(params))
+	for key := range params {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var buffer bytes.Buffer
+	for i, key := range keys {
+		if i > 0 {
+			buffer.WriteString("&")
+		}
+		value := params[key]
+		if !mysqlRawParams[key] {
+			value = url.QueryEscape(value)
+		}
+		buffer.WriteString(key + "=" + value)
+	}
+	return buffer.String()
+}
+
+func (o *MySqlService) configurePool() {
+	maxOpenConns := o.mysql.MaxOpenConns
+	if maxOpenConns == 0 {
+		maxOpenConns = defaultMaxOpenConns
+	}
+	o.db.SetMaxOpenConns(maxOpenConns)
+	if o.mysql.MaxIdleConns != 0 {
+		o.db.SetMaxIdleConns(o.mysql.MaxIdleConns)
+	}
+	if o.mysql.ConnMaxLifetimeMillis > 0 {
+		o.db.SetConnMaxLifetime(time.Duration(o.mysql.ConnMaxLifetimeMillis) * time.Millisecond)
+	}
+}
+
+//poolStats returns the stats of the connection pool, 'initialized' is false before the first connection
+func (o *MySqlService) poolStats() (ret map[string]interface{}) {
+	ret = map[string]interface{}{"initialized": o.db != nil}
+	if o.db == nil {
+		return
+	}
+	stats := o.db.Stats()
+	ret["max_open_connections"] = stats.MaxOpenConnections
+	ret["open_connections"] = stats.OpenConnections
+	ret["in_use"] = stats.InUse
+	ret["idle"] = stats.Idle
+	ret["wait_count"] = stats.WaitCount
+	ret["wait_duration_ms"] = stats.WaitDuration.Nanoseconds() / int64(time.Millisecond)
+	ret["max_idle_closed"] = stats.MaxIdleClosed
+	ret["max_lifetime_closed"] = stats.MaxLifetimeClosed
+	if maxOpen := stats.MaxOpenConnections; maxOpen > 0 {
+		ret["usage_percent"] = float64(stats.InUse) / float64(maxOpen) * 100
+	}
+	o.stmtsLock.Lock()
+	ret["cached_statements"] = len(o.stmts)
+	o.stmtsLock.Unlock()
+	return
+}
+
 func (o *MySqlService) Close() {
+	o.stmtsLock.Lock()
+	for _, stmt := range o.stmts {
+		o.evict(stmt)
+	}
+	o.stmtsLock.Unlock()
+
 	if o.db != nil {
 		if err := o.db.Close(); err != nil {
 			Log.Debug("Closing Index connection of %v caused error %v", o.Name, err)
@@ -159,56 +271,183 @@ func (o *MySqlService) json(sql string) (json string, err error) {
 	return
 }*/
 
-func (o *MySqlService) queryToWriter(sql string, writer eio.MapWriter) (err error) {
-	rows, err := o.query(sql)
+func (o *MySqlService) queryToWriter(sql string, writer eio.MapWriter, args ...interface{}) (err error) {
+	rows, err := o.query(sql, args...)
 	if err != nil {
 		return
 	}
 	defer rows.Close()
-	columns, err := rows.Columns()
+	columnTypes, err := rows.ColumnTypes()
 	if err != nil {
 		return
 	}
-	count := len(columns)
+	count := len(columnTypes)
 	values := make([]interface{}, count)
 	valuePtrs := make([]interface{}, count)
 	for rows.Next() {
 		for i := 0; i < count; i++ {
 			valuePtrs[i] = &values[i]
 		}
-		rows.Scan(valuePtrs...)
+		if err = rows.Scan(valuePtrs...); err != nil {
+			break
+		}
 		entry := make(map[string]interface{})
-		for i, col := range columns {
-			var v interface{}
-			val := values[i]
-			b, ok := val.([]byte)
-			if ok {
-				str := string(b)
-				if d, conErr := strconv.Atoi(str); conErr == nil {
-					v = d
-				} else {
-					v = str
-				}
-			} else {
-				v = val
-			}
-			entry[col] = v
+		for i, columnType := range columnTypes {
+			entry[columnType.Name()] = mySqlValue(columnType.DatabaseTypeName(), values[i])
 		}
 		if err = writer.WriteMap(entry); err != nil {
-			break;
+			break
 		}
 	}
+	if err == nil {
+		err = rows.Err()
+	}
 	return
 }
 
-func (o *MySqlService) query(sql string) (*sql.Rows, error) {
+//mySqlValue converts the value by the column type: integers to int64 (uint64 if too big), decimals and floats
+//to float64, BIT(1) to bool, dates to time.Time (UTC), binary to base64, others to string and NULL to nil
+func mySqlValue(typeName string, value interface{}) interface{} {
+	var data []byte
+	switch item := value.(type) {
+	case nil:
+		return nil
+	case []byte:
+		data = item
+	case string:
+		data = []byte(item)
+	default:
+		//binary protocol of prepared statements, e.g. int64, float64 or time.Time
+		return item
+	}
+
+	text := string(data)
+	switch baseType := strings.TrimPrefix(strings.ToUpper(typeName), "UNSIGNED "); baseType {
+	case "TINYINT", "SMALLINT", "MEDIUMINT", "INT", "INTEGER", "BIGINT", "YEAR":
+		if number, err := strconv.ParseInt(text, 10, 64); err == nil {
+			return number
+		}
+		if number, err := strconv.ParseUint(text, 10, 64); err == nil {
+			return number
+		}
+	case "DECIMAL", "FLOAT", "DOUBLE":
+		if number, err := strconv.ParseFloat(text, 64); err == nil {
+			return number
+		}
+	case "BIT":
+		var number uint64
+		for _, b := range data {
+			number = number<<8 | uint64(b)
+		}
+		if len(data) == 1 && number <= 1 {
+			return number == 1
+		}
+		return number
+	case "DATE", "DATETIME", "TIMESTAMP":
+		if strings.HasPrefix(text, "0000-00-00") {
+			return nil
+		}
+		layout := "2006-01-02 15:04:05.999999999"
+		if baseType == "DATE" {
+			layout = "2006-01-02"
+		}
+		if parsed, err := time.ParseInLocation(layout, text, time.UTC); err == nil {
+			return parsed
+		}
+	case "BINARY", "VARBINARY", "TINYBLOB", "BLOB", "MEDIUMBLOB", "LONGBLOB", "GEOMETRY":
+		return base64.StdEncoding.EncodeToString(data)
+	}
+	return text
+}
+
+func (o *MySqlService) query(sql string, args ...interface{}) (*sql.Rows, error) {
+	if len(args) > 0 {
+		return o.queryPrepared(sql, args...)
+	}
 	if o.queryTimeout > 0 {
-		return o.db.QueryContext(TimeoutContext(o.queryTimeout), sql)
+		return o.db.QueryContext(TimeoutContext(o.queryTimeout), sql, args...)
 	} else {
-		return o.db.Query(sql)
+		return o.db.Query(sql, args...)
 	}
 }
 
+//queryPrepared executes the query as a prepared statement, which is cached per service
+func (o *MySqlService) queryPrepared(query string, args ...interface{}) (ret *sql.Rows, err error) {
+	var stmt *cachedStmt
+	if stmt, err = o.prepare(query); err != nil {
+		return
+	}
+	//the rows keep the statement open, it can be released after the query
+	defer o.release(stmt)
+	if o.queryTimeout > 0 {
+		return stmt.stmt.QueryContext(TimeoutContext(o.queryTimeout), args...)
+	} else {
+		return stmt.stmt.Query(args...)
+	}
+}
+
+//prepare returns the cached statement for the query, it must be released after the use
+func (o *MySqlService) prepare(query string) (ret *cachedStmt, err error) {
+	o.stmtsLock.Lock()
+	defer o.stmtsLock.Unlock()
+
+	o.stmtsUsed++
+	if ret = o.stmts[query]; ret == nil {
+		var stmt *sql.Stmt
+		if stmt, err = o.db.Prepare(query); err != nil {
+			return
+		}
+		if len(o.stmts) >= maxCachedStatements {
+			o.evict(o.leastRecentlyUsed())
+		}
+		if o.stmts == nil {
+			o.stmts = make(map[string]*cachedStmt)
+		}
+		ret = &cachedStmt{query: query, stmt: stmt}
+		o.stmts[query] = ret
+	}
+	ret.users++
+	ret.used = o.stmtsUsed
+	return
+}
+
+func (o *MySqlService) release(stmt *cachedStmt) {
+	o.stmtsLock.Lock()
+	defer o.stmtsLock.Unlock()
+
+	stmt.users--
+	if stmt.evicted {
+		o.closeStatement(stmt)
+	}
+}
+
+func (o *MySqlService) leastRecentlyUsed() (ret *cachedStmt) {
+	for _, stmt := range o.stmts {
+		if ret == nil || stmt.used < ret.used {
+			ret = stmt
+		}
+	}
+	return
+}
+
+//evict removes the statement from the cache, it is closed after the last use
+func (o *MySqlService) evict(stmt *cachedStmt) {
+	Log.Debug("The statement '%v' is evicted from the cache of %v", stmt.query, o.Name())
+	delete(o.stmts, stmt.query)
+	stmt.evicted = true
+	o.closeStatement(stmt)
+}
+
+func (o *MySqlService) closeStatement(stmt *cachedStmt) {
+	if stmt.users > 0 || stmt.stmt == nil {
+		return
+	}
+	if err := stmt.stmt.Close(); err != nil {
+		Log.Debug("Closing of the statement '%v' of %v caused error %v", stmt.query, o.Name(), err)
+	}
+	stmt.stmt = nil
+}
+
 func (o *MySqlService) NewExecutor(req *CommandRequest) (ret Executor, err error) {
 	return nil, errors.New(fmt.Sprintf("Not implemented yet in %v", o.Name()))
 }
@@ -219,14 +458,65 @@ func (o *MySqlService) NewСheck(req *ValidationRequest) (ret Check, err error)
 		return
 	}
 
-	if err = o.validateQuery(req.Query); err != nil {
+	var aggr *aggregation
+	if aggr, err = compileAggr(req.AggrExpr); err != nil {
+		return
+	}
+
+	query := req.Query
+	var tables []string
+	var longRunning float64
+	kind := strings.ToLower(req.Kind)
+	switch kind {
+	case "", MySqlQuery:
+		kind = MySqlQuery
+		limit := req.Limit
+		if limit == 0 {
+			limit = DefaultQueryLimit
+		}
+		if query, err = readOnlyQuery(req.Query, limit); err != nil {
+			return
+		}
+		var questionMarks []int
+		if questionMarks, err = sqlQuestionMarks(query); err != nil {
+			return
+		}
+		if len(questionMarks) != len(req.Args) {
+			err = errors.New(fmt.Sprintf("The query '%v' has %v '?' parameters, but %v args are given",
+				req.Query, len(questionMarks), len(req.Args)))
+			return
+		}
+	case MySqlSchema:
+		//the query is the schema, default is the database of the service
+		query = strings.TrimSpace(query)
+		if len(query) > 0 && !sqlIdentifierPattern.MatchString(query) {
+			err = errors.New(fmt.Sprintf("'%v' is not a valid schema name", query))
+			return
+		}
+	case MySqlChecksum:
+		if tables, err = checksumTables(req.Query); err != nil {
+			return
+		}
+	case MySqlProcessList:
+		//the query is the threshold of long running queries, e.g. '30s', default 60s
+		longRunning = defaultLongRunningSeconds
+		if query = strings.TrimSpace(query); len(query) > 0 {
+			var seconds interface{}
+			if seconds, err = evalParseDuration(query); err != nil {
+				return
+			}
+			longRunning = seconds.(float64)
+		}
+	case MySqlReplica, MySqlGalera, MySqlInnoDb, MySqlConnections, MySqlPool:
+	default:
+		err = errors.New(fmt.Sprintf("The kind '%v' is not supported by %v", req.Kind, o.Name()))
 		return
 	}
 
-	query := o.limitQuery(req.Query)
 	ret = &mySqlCheck{
-		info: req.CheckKey(o.Name()), query: query, service: o,
-		eval: eval, all: req.All}
+		info: req.CheckKey(o.Name()), kind: kind, query: query, args: req.Args, tables: tables, longRunning: longRunning,
+		service: o,
+		eval: eval, all: req.All, aggr: aggr}
 	return
 }
 
@@ -238,10 +528,17 @@ func (o *MySqlService) NewExporter(req *ExportRequest) (ret Exporter, err error)
 //buildCheck
 type mySqlCheck struct {
 	info    string
+	kind    string
 	query   string
+	args    []string
+	tables  []string
 	all     bool
 	eval    *govaluate.EvaluableExpression
+	aggr    *aggregation
 	service *MySqlService
+
+	//processlist: threshold of long running queries in seconds
+	longRunning float64
 }
 
 func (o mySqlCheck) Info() string {
@@ -249,15 +546,50 @@ func (o mySqlCheck) Info() string {
 }
 
 func (o *mySqlCheck) Validate() error {
-	return validate(o, o.eval, o.all)
+	return validate(o, o.eval, o.all, o.aggr)
 }
 
 func (o *mySqlCheck) Query() (ret QueryResults, err error) {
-	if err = o.service.Init(); err == nil {
-		writer := NewQueryResultMapWriter()
-		if err = o.service.queryToWriter(o.query, writer); err == nil {
-			ret = writer.Data
+	if err = o.service.Init(); err != nil {
+		return
+	}
+
+	if o.kind != MySqlQuery {
+		var rows []map[string]interface{}
+		switch o.kind {
+		case MySqlSchema:
+			rows, err = o.service.schema(o.query)
+		case MySqlChecksum:
+			rows, err = o.service.checksum(o.tables)
+		case MySqlReplica:
+			rows, err = o.service.replica()
+		case MySqlGalera:
+			rows, err = o.service.galera()
+		case MySqlProcessList:
+			rows, err = o.service.processList(o.longRunning)
+		case MySqlInnoDb:
+			rows, err = o.service.innoDb()
+		case MySqlConnections:
+			rows, err = o.service.connections()
+		case MySqlPool:
+			rows = []map[string]interface{}{o.service.poolStats()}
+		}
+		for _, row := range rows {
+			ret = append(ret, &MapQueryResult{row})
 		}
+		return
+	}
+
+	//time placeholders are evaluated for every run
+	var query string
+	var args []interface{}
+	if query, args, err = bindSqlQuery(o.query, nil, argValues(o.args)); err != nil {
+		return
+	}
+
+	writer := NewQueryResultMapWriter()
+	if err = o.service.queryToWriter(query, writer, args...); err == nil {
+		ret = writer.Data
 	}
 	return
 }
@@ -277,12 +609,23 @@ func (o *mySqlExporter) Export(params map[string]string) (err error) {
 		return
 	}
 
+	var query string
+	var args []interface{}
+	//'?' parameters are bound to the declared params in their order
+	var positional []interface{}
+	if questionMarks, _ := sqlQuestionMarks(o.req.Query); len(questionMarks) > 0 {
+		positional = positionalValues(o.req.Params, params)
+	}
+	if query, args, err = bindSqlQuery(o.req.Query, params, positional); err != nil {
+		return
+	}
+
 	var out io.WriteCloser
 	if out, err = o.req.CreateOut(params); err != nil {
 		return
 	}
-	defer out.Close()
+	defer closeExportOut(out, &err)
 
-	err = o.service.queryToWriter(o.req.Query, &eio.WriteCloserMapWriter{Convert: o.req.Convert, Out: out})
+	err = o.service.queryToWriter(query, &eio.WriteCloserMapWriter{Convert: o.req.Convert, Out: out}, args...)
 	return
 }
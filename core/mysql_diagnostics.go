@@ -0,0 +1,184 @@
+package core
+
+import (
+	"strconv"
+	"strings"
+)
+
+const (
+	MySqlReplica     = "replica"
+	MySqlGalera      = "galera"
+	MySqlProcessList = "processlist"
+	MySqlInnoDb      = "innodb"
+	MySqlConnections = "connections"
+	MySqlPool        = "pool"
+)
+
+//default threshold of long running queries in seconds
+const defaultLongRunningSeconds = 60
+
+//replica returns a row per replication channel, no rows if the server is no replica
+func (o *MySqlService) replica() (ret []map[string]interface{}, err error) {
+	var rows []map[string]interface{}
+	if rows, err = o.queryMaps("SHOW REPLICA STATUS"); err != nil {
+		//before MySQL 8.0.22 and MariaDB 10.5.1
+		if rows, err = o.queryMaps("SHOW SLAVE STATUS"); err != nil {
+			return
+		}
+	}
+	for _, row := range rows {
+		ret = append(ret, replicaRow(row))
+	}
+	return
+}
+
+//replicaRow maps the fields of SHOW REPLICA STATUS and SHOW SLAVE STATUS to the same typed fields
+func replicaRow(row map[string]interface{}) map[string]interface{} {
+	field := func(names ...string) interface{} {
+		for _, name := range names {
+			if value, ok := row[name]; ok {
+				return value
+			}
+		}
+		return nil
+	}
+	ioRunning := strings.EqualFold(toText(field("Replica_IO_Running", "Slave_IO_Running")), "Yes")
+	sqlRunning := strings.EqualFold(toText(field("Replica_SQL_Running", "Slave_SQL_Running")), "Yes")
+	return map[string]interface{}{
+		"channel":         toText(field("Channel_Name", "Connection_name")),
+		"source_host":     toText(field("Source_Host", "Master_Host")),
+		"source_port":     typedValue(field("Source_Port", "Master_Port")),
+		"io_running":      ioRunning,
+		"sql_running":     sqlRunning,
+		"running":         ioRunning && sqlRunning,
+		"seconds_behind":  typedValue(field("Seconds_Behind_Source", "Seconds_Behind_Master")),
+		"last_io_error":   toText(field("Last_IO_Error")),
+		"last_sql_error":  toText(field("Last_SQL_Error")),
+		"last_io_errno":   typedValue(field("Last_IO_Errno")),
+		"last_sql_errno":  typedValue(field("Last_SQL_Errno")),
+		"relay_log_space": typedValue(field("Relay_Log_Space")),
+	}
+}
+
+//galera returns the wsrep status variables as one row, with the flags ready, synced and primary
+func (o *MySqlService) galera() (ret []map[string]interface{}, err error) {
+	var status map[string]interface{}
+	if status, err = o.status("SHOW GLOBAL STATUS LIKE 'wsrep_%'"); err == nil {
+		ret = []map[string]interface{}{galeraRow(status)}
+	}
+	return
+}
+
+func galeraRow(status map[string]interface{}) map[string]interface{} {
+	status["ready"] = strings.EqualFold(toText(status["wsrep_ready"]), "ON")
+	status["connected"] = strings.EqualFold(toText(status["wsrep_connected"]), "ON")
+	status["synced"] = strings.EqualFold(toText(status["wsrep_local_state_comment"]), "Synced")
+	status["primary"] = strings.EqualFold(toText(status["wsrep_cluster_status"]), "Primary")
+	return status
+}
+
+//processList returns the active queries of other connections, 'long_running' is set if they run longer than the threshold
+func (o *MySqlService) processList(longRunningSeconds float64) (ret []map[string]interface{}, err error) {
+	var rows []map[string]interface{}
+	if rows, err = o.queryMaps("SELECT ID, USER, HOST, DB, COMMAND, TIME, STATE, INFO " +
+		"FROM information_schema.PROCESSLIST WHERE COMMAND NOT IN ('Sleep', 'Daemon', 'Binlog Dump') " +
+		"AND ID <> CONNECTION_ID() ORDER BY TIME DESC"); err != nil {
+		return
+	}
+	for _, row := range rows {
+		ret = append(ret, processRow(row, longRunningSeconds))
+	}
+	return
+}
+
+func processRow(row map[string]interface{}, longRunningSeconds float64) map[string]interface{} {
+	ret := make(map[string]interface{}, len(row)+1)
+	for key, value := range row {
+		ret[strings.ToLower(key)] = typedValue(value)
+	}
+	seconds, _ := toFloat(ret["time"])
+	ret["long_running"] = seconds >= longRunningSeconds
+	return ret
+}
+
+//innoDb returns the InnoDB status variables as one row, with the buffer pool hit ratio and usage
+func (o *MySqlService) innoDb() (ret []map[string]interface{}, err error) {
+	var status map[string]interface{}
+	if status, err = o.status("SHOW GLOBAL STATUS LIKE 'Innodb_%'"); err == nil {
+		ret = []map[string]interface{}{innoDbRow(status)}
+	}
+	return
+}
+
+func innoDbRow(status map[string]interface{}) map[string]interface{} {
+	readRequests, _ := toFloat(status["innodb_buffer_pool_read_requests"])
+	reads, _ := toFloat(status["innodb_buffer_pool_reads"])
+	if readRequests > 0 {
+		status["buffer_pool_hit_ratio"] = 1 - reads/readRequests
+	}
+	total, _ := toFloat(status["innodb_buffer_pool_pages_total"])
+	free, _ := toFloat(status["innodb_buffer_pool_pages_free"])
+	if total > 0 {
+		status["buffer_pool_used_percent"] = (total - free) / total * 100
+	}
+	return status
+}
+
+//connections returns the used connections compared to max_connections
+func (o *MySqlService) connections() (ret []map[string]interface{}, err error) {
+	var status, variables map[string]interface{}
+	if status, err = o.status("SHOW GLOBAL STATUS WHERE Variable_name IN ('Threads_connected', " +
+		"'Threads_running', 'Max_used_connections', 'Aborted_connects', 'Connection_errors_max_connections')"); err != nil {
+		return
+	}
+	if variables, err = o.status("SHOW GLOBAL VARIABLES LIKE 'max_connections'"); err != nil {
+		return
+	}
+	ret = []map[string]interface{}{connectionsRow(status, variables)}
+	return
+}
+
+func connectionsRow(status map[string]interface{}, variables map[string]interface{}) map[string]interface{} {
+	status["max_connections"] = variables["max_connections"]
+	maxConnections, _ := toFloat(variables["max_connections"])
+	if maxConnections > 0 {
+		connected, _ := toFloat(status["threads_connected"])
+		maxUsed, _ := toFloat(status["max_used_connections"])
+		status["usage_percent"] = connected / maxConnections * 100
+		status["max_used_percent"] = maxUsed / maxConnections * 100
+	}
+	return status
+}
+
+//status reads the Variable_name and Value rows of SHOW STATUS or SHOW VARIABLES as one row with lower case names
+func (o *MySqlService) status(sql string) (ret map[string]interface{}, err error) {
+	var rows []map[string]interface{}
+	if rows, err = o.queryMaps(sql); err == nil {
+		ret = statusRow(rows)
+	}
+	return
+}
+
+func statusRow(rows []map[string]interface{}) (ret map[string]interface{}) {
+	ret = make(map[string]interface{}, len(rows))
+	for _, row := range rows {
+		ret[strings.ToLower(toText(row["Variable_name"]))] = typedValue(row["Value"])
+	}
+	return
+}
+
+//typedValue converts numeric texts to numbers, for the evaluation
+func typedValue(value interface{}) interface{} {
+	if b, ok := value.([]byte); ok {
+		value = string(b)
+	}
+	if text, ok := value.(string); ok {
+		if number, err := strconv.ParseInt(text, 10, 64); err == nil {
+			return number
+		}
+		if number, err := strconv.ParseFloat(text, 64); err == nil {
+			return number
+		}
+	}
+	return value
+}
@@ -0,0 +1,192 @@
+package core
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+const (
+	MySqlQuery    = "query"
+	MySqlSchema   = "schema"
+	MySqlChecksum = "checksum"
+)
+
+//fields of the schema and checksum rows
+const (
+	SchemaObject     = "object"
+	SchemaType       = "type"
+	SchemaDefinition = "definition"
+
+	ChecksumTable = "table"
+	ChecksumValue = "checksum"
+)
+
+var sqlIdentifierPattern = regexp.MustCompile(`^[A-Za-z0-9_$]+(\.[A-Za-z0-9_$]+)?$`)
+
+//the schema of the query or the current database
+const schemaCondition = "= COALESCE(NULLIF(?, ''), DATABASE())"
+
+//compareDefaults returns the join keys and equal fields of the kind, used if a compare check defines none
+func compareDefaults(kind string) (joinKeys []string, equalFields []string) {
+	switch strings.ToLower(kind) {
+	case MySqlSchema:
+		joinKeys, equalFields = []string{SchemaObject}, []string{SchemaType, SchemaDefinition}
+	case MySqlChecksum:
+		joinKeys, equalFields = []string{ChecksumTable}, []string{ChecksumValue}
+	}
+	return
+}
+
+//checksumTables parses the comma separated table names, e.g. 'countries, ref.currencies'
+func checksumTables(query string) (ret []string, err error) {
+	for _, table := range strings.Split(query, ",") {
+		if table = strings.TrimSpace(table); len(table) == 0 {
+			continue
+		}
+		if !sqlIdentifierPattern.MatchString(table) {
+			err = errors.New(fmt.Sprintf("'%v' is not a valid table name", table))
+			return
+		}
+		ret = append(ret, table)
+	}
+	if len(ret) == 0 {
+		err = errors.New("Tables for the checksum are missing in the query")
+	}
+	return
+}
+
+func quoteIdentifier(name string) string {
+	parts := strings.Split(name, ".")
+	for i, part := range parts {
+		parts[i] = "`" + part + "`"
+	}
+	return strings.Join(parts, ".")
+}
+
+//schema reads tables, columns, indexes and routines from the information_schema, a row per object
+func (o *MySqlService) schema(schema string) (ret []map[string]interface{}, err error) {
+	for _, item := range []struct {
+		query string
+		rows  func([]map[string]interface{}) []map[string]interface{}
+	}{
+		{"SELECT TABLE_NAME, TABLE_TYPE, ENGINE, TABLE_COLLATION FROM information_schema.TABLES " +
+			"WHERE TABLE_SCHEMA " + schemaCondition, tableSchemaRows},
+		{"SELECT TABLE_NAME, COLUMN_NAME, ORDINAL_POSITION, COLUMN_TYPE, IS_NULLABLE, COLUMN_DEFAULT, EXTRA, " +
+			"COLLATION_NAME FROM information_schema.COLUMNS WHERE TABLE_SCHEMA " + schemaCondition, columnSchemaRows},
+		{"SELECT TABLE_NAME, INDEX_NAME, NON_UNIQUE, COLUMN_NAME, INDEX_TYPE FROM information_schema.STATISTICS " +
+			"WHERE TABLE_SCHEMA " + schemaCondition + " ORDER BY TABLE_NAME, INDEX_NAME, SEQ_IN_INDEX", indexSchemaRows},
+		{"SELECT ROUTINE_NAME, ROUTINE_TYPE, DTD_IDENTIFIER, ROUTINE_DEFINITION FROM information_schema.ROUTINES " +
+			"WHERE ROUTINE_SCHEMA " + schemaCondition, routineSchemaRows},
+	} {
+		var rows []map[string]interface{}
+		if rows, err = o.queryMaps(item.query, schema); err != nil {
+			return
+		}
+		ret = append(ret, item.rows(rows)...)
+	}
+	return
+}
+
+//checksum runs CHECKSUM TABLE for every table, the checksum is nil for missing tables
+func (o *MySqlService) checksum(tables []string) (ret []map[string]interface{}, err error) {
+	for _, table := range tables {
+		var rows []map[string]interface{}
+		if rows, err = o.queryMaps("CHECKSUM TABLE " + quoteIdentifier(table)); err != nil {
+			return
+		}
+		row := map[string]interface{}{ChecksumTable: table, ChecksumValue: nil}
+		if len(rows) > 0 {
+			row[ChecksumValue] = rows[0]["Checksum"]
+		}
+		ret = append(ret, row)
+	}
+	return
+}
+
+func (o *MySqlService) queryMaps(sql string, args ...interface{}) (ret []map[string]interface{}, err error) {
+	writer := NewQueryResultMapWriter()
+	if err = o.queryToWriter(sql, writer, args...); err == nil {
+		for _, item := range writer.Data {
+			ret = append(ret, item.(*MapQueryResult).Data)
+		}
+	}
+	return
+}
+
+func schemaRow(objectType string, object string, definition string) map[string]interface{} {
+	return map[string]interface{}{SchemaObject: objectType + ":" + object, SchemaType: objectType,
+		SchemaDefinition: definition}
+}
+
+func tableSchemaRows(rows []map[string]interface{}) (ret []map[string]interface{}) {
+	for _, row := range rows {
+		ret = append(ret, schemaRow("table", toText(row["TABLE_NAME"]), fmt.Sprintf("%v engine=%v collation=%v",
+			toText(row["TABLE_TYPE"]), toText(row["ENGINE"]), toText(row["TABLE_COLLATION"]))))
+	}
+	return
+}
+
+func columnSchemaRows(rows []map[string]interface{}) (ret []map[string]interface{}) {
+	for _, row := range rows {
+		definition := fmt.Sprintf("%v position=%v nullable=%v", toText(row["COLUMN_TYPE"]),
+			toText(row["ORDINAL_POSITION"]), toText(row["IS_NULLABLE"]))
+		if row["COLUMN_DEFAULT"] != nil {
+			definition += fmt.Sprintf(" default=%v", toText(row["COLUMN_DEFAULT"]))
+		}
+		if extra := toText(row["EXTRA"]); len(extra) > 0 {
+			definition += " " + extra
+		}
+		if row["COLLATION_NAME"] != nil {
+			definition += fmt.Sprintf(" collation=%v", toText(row["COLLATION_NAME"]))
+		}
+		ret = append(ret, schemaRow("column", toText(row["TABLE_NAME"])+"."+toText(row["COLUMN_NAME"]), definition))
+	}
+	return
+}
+
+//indexSchemaRows groups the index columns, which are ordered by table, index and sequence, to a row per index
+func indexSchemaRows(rows []map[string]interface{}) (ret []map[string]interface{}) {
+	var current string
+	var columns []string
+	var first map[string]interface{}
+	flush := func() {
+		if first != nil {
+			unique := "unique"
+			if toText(first["NON_UNIQUE"]) != "0" {
+				unique = "non-unique"
+			}
+			ret = append(ret, schemaRow("index", current, fmt.Sprintf("%v %v (%v)", unique,
+				toText(first["INDEX_TYPE"]), strings.Join(columns, ", "))))
+		}
+	}
+	for _, row := range rows {
+		name := toText(row["TABLE_NAME"]) + "." + toText(row["INDEX_NAME"])
+		if name != current {
+			flush()
+			current, columns, first = name, nil, row
+		}
+		columns = append(columns, toText(row["COLUMN_NAME"]))
+	}
+	flush()
+	return
+}
+
+//routineSchemaRows compares the routine bodies by their hash
+func routineSchemaRows(rows []map[string]interface{}) (ret []map[string]interface{}) {
+	for _, row := range rows {
+		definition := toText(row["ROUTINE_TYPE"])
+		if returns := toText(row["DTD_IDENTIFIER"]); len(returns) > 0 {
+			definition += " returns " + returns
+		}
+		if body := toText(row["ROUTINE_DEFINITION"]); len(body) > 0 {
+			hash := sha1.Sum([]byte(body))
+			definition += " body=" + hex.EncodeToString(hash[:])
+		}
+		ret = append(ret, schemaRow("routine", toText(row["ROUTINE_NAME"]), definition))
+	}
+	return
+}
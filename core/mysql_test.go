@@ -1,8 +1,17 @@
 package core
 
 import (
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync/atomic"
 	"testing"
-	_ "github.com/go-sql-driver/mysql"
+	"time"
+	"github.com/eugeis/gee/as"
+	"github.com/go-sql-driver/mysql"
 )
 
 func TestMySqlService(t *testing.T) {
@@ -19,3 +28,271 @@ func TestMySqlService(t *testing.T) {
 		println(err.Error())
 	}
 }
+
+func TestSchemaRows(t *testing.T) {
+	columns := columnSchemaRows([]map[string]interface{}{
+		{"TABLE_NAME": "users", "COLUMN_NAME": "id", "ORDINAL_POSITION": 1, "COLUMN_TYPE": "int(11)",
+			"IS_NULLABLE": "NO", "COLUMN_DEFAULT": nil, "EXTRA": "auto_increment", "COLLATION_NAME": nil},
+		{"TABLE_NAME": "users", "COLUMN_NAME": "name", "ORDINAL_POSITION": 2, "COLUMN_TYPE": "varchar(64)",
+			"IS_NULLABLE": "YES", "COLUMN_DEFAULT": "", "EXTRA": "", "COLLATION_NAME": "utf8_bin"},
+	})
+	AssertEqual(t, len(columns), 2, nil)
+	AssertEqual(t, columns[0][SchemaObject], "column:users.id", nil)
+	AssertEqual(t, columns[0][SchemaDefinition], "int(11) position=1 nullable=NO auto_increment", nil)
+	AssertEqual(t, columns[1][SchemaDefinition], "varchar(64) position=2 nullable=YES default= collation=utf8_bin", nil)
+
+	indexes := indexSchemaRows([]map[string]interface{}{
+		{"TABLE_NAME": "users", "INDEX_NAME": "PRIMARY", "NON_UNIQUE": 0, "COLUMN_NAME": "id", "INDEX_TYPE": "BTREE"},
+		{"TABLE_NAME": "users", "INDEX_NAME": "name_idx", "NON_UNIQUE": 1, "COLUMN_NAME": "name", "INDEX_TYPE": "BTREE"},
+		{"TABLE_NAME": "users", "INDEX_NAME": "name_idx", "NON_UNIQUE": 1, "COLUMN_NAME": "id", "INDEX_TYPE": "BTREE"},
+	})
+	AssertEqual(t, len(indexes), 2, nil)
+	AssertEqual(t, indexes[0][SchemaDefinition], "unique BTREE (id)", nil)
+	AssertEqual(t, indexes[1][SchemaObject], "index:users.name_idx", nil)
+	AssertEqual(t, indexes[1][SchemaDefinition], "non-unique BTREE (name, id)", nil)
+
+	routines := routineSchemaRows([]map[string]interface{}{
+		{"ROUTINE_NAME": "total", "ROUTINE_TYPE": "FUNCTION", "DTD_IDENTIFIER": "int(11)", "ROUTINE_DEFINITION": "RETURN 1"},
+	})
+	AssertEqual(t, strings.HasPrefix(routines[0][SchemaDefinition].(string), "FUNCTION returns int(11) body="), true, nil)
+}
+
+func TestChecksumTables(t *testing.T) {
+	tables, err := checksumTables(" countries, ref.currencies ")
+	AssertEqual(t, err, nil, ErrorMessageBuilder)
+	AssertEqual(t, strings.Join(tables, "|"), "countries|ref.currencies", nil)
+	AssertEqual(t, quoteIdentifier(tables[1]), "`ref`.`currencies`", nil)
+
+	_, err = checksumTables("users; DROP TABLE users")
+	AssertEqual(t, err != nil, true, nil)
+	_, err = checksumTables(" ")
+	AssertEqual(t, err != nil, true, nil)
+
+	service := &MySqlService{mysql: &MySql{Name: "mysql"}}
+	_, err = service.NewСheck(&ValidationRequest{Kind: MySqlSchema, Query: "app` --"})
+	AssertEqual(t, err != nil, true, nil)
+	_, err = service.NewСheck(&ValidationRequest{Kind: "unknown"})
+	AssertEqual(t, err != nil, true, nil)
+
+	joinKeys, equalFields := compareDefaults("Schema")
+	AssertEqual(t, joinKeys[0], SchemaObject, nil)
+	AssertEqual(t, len(equalFields), 2, nil)
+}
+
+func TestMySqlDiagnosticRows(t *testing.T) {
+	replica := replicaRow(map[string]interface{}{"Master_Host": "db1", "Master_Port": 3306,
+		"Slave_IO_Running": "Yes", "Slave_SQL_Running": "No", "Seconds_Behind_Master": nil, "Last_SQL_Error": "dup"})
+	AssertEqual(t, replica["source_host"], "db1", nil)
+	AssertEqual(t, replica["io_running"], true, nil)
+	AssertEqual(t, replica["running"], false, nil)
+	AssertEqual(t, replica["seconds_behind"], nil, nil)
+	replica = replicaRow(map[string]interface{}{"Replica_IO_Running": "Yes", "Replica_SQL_Running": "Yes",
+		"Seconds_Behind_Source": "12"})
+	AssertEqual(t, replica["running"], true, nil)
+	AssertEqual(t, replica["seconds_behind"], int64(12), nil)
+
+	galera := galeraRow(statusRow([]map[string]interface{}{
+		{"Variable_name": "wsrep_ready", "Value": "ON"},
+		{"Variable_name": "wsrep_cluster_size", "Value": "3"},
+		{"Variable_name": "wsrep_local_state_comment", "Value": "Synced"},
+		{"Variable_name": "wsrep_flow_control_paused", "Value": "0.25"},
+	}))
+	AssertEqual(t, galera["ready"], true, nil)
+	AssertEqual(t, galera["synced"], true, nil)
+	AssertEqual(t, galera["primary"], false, nil)
+	AssertEqual(t, galera["wsrep_cluster_size"], int64(3), nil)
+	AssertEqual(t, galera["wsrep_flow_control_paused"], 0.25, nil)
+
+	process := processRow(map[string]interface{}{"ID": 7, "TIME": 90, "INFO": "SELECT SLEEP(100)"}, 60)
+	AssertEqual(t, process["long_running"], true, nil)
+	AssertEqual(t, process["info"], "SELECT SLEEP(100)", nil)
+
+	innoDb := innoDbRow(map[string]interface{}{"innodb_buffer_pool_read_requests": 1000,
+		"innodb_buffer_pool_reads": 10, "innodb_buffer_pool_pages_total": 200, "innodb_buffer_pool_pages_free": 50})
+	AssertEqual(t, innoDb["buffer_pool_hit_ratio"], 0.99, nil)
+	AssertEqual(t, innoDb["buffer_pool_used_percent"], 75.0, nil)
+
+	connections := connectionsRow(map[string]interface{}{"threads_connected": 50, "max_used_connections": 80},
+		map[string]interface{}{"max_connections": int64(200)})
+	AssertEqual(t, connections["usage_percent"], 25.0, nil)
+	AssertEqual(t, connections["max_used_percent"], 40.0, nil)
+
+	service := &MySqlService{mysql: &MySql{Name: "mysql"}}
+	check, err := service.NewСheck(&ValidationRequest{Kind: MySqlProcessList, Query: "30s"})
+	AssertEqual(t, err, nil, ErrorMessageBuilder)
+	AssertEqual(t, check.(*mySqlCheck).longRunning, 30.0, nil)
+	_, err = service.NewСheck(&ValidationRequest{Kind: MySqlProcessList, Query: "long"})
+	AssertEqual(t, err != nil, true, nil)
+}
+
+func TestMySqlValue(t *testing.T) {
+	AssertEqual(t, mySqlValue("INT", []byte("-12")), int64(-12), nil)
+	AssertEqual(t, mySqlValue("UNSIGNED BIGINT", []byte("18446744073709551615")), uint64(18446744073709551615), nil)
+	AssertEqual(t, mySqlValue("DECIMAL", []byte("12.50")), 12.5, nil)
+	AssertEqual(t, mySqlValue("DOUBLE", []byte("1e3")), 1000.0, nil)
+	AssertEqual(t, mySqlValue("BIT", []byte{1}), true, nil)
+	AssertEqual(t, mySqlValue("BIT", []byte{1, 2}), uint64(258), nil)
+	AssertEqual(t, mySqlValue("VARCHAR", []byte("007")), "007", nil)
+	AssertEqual(t, mySqlValue("TEXT", nil), nil, nil)
+	AssertEqual(t, mySqlValue("VARBINARY", []byte{0, 255}), "AP8=", nil)
+	AssertEqual(t, mySqlValue("BIGINT", int64(7)), int64(7), nil)
+	AssertEqual(t, mySqlValue("DATETIME", []byte("0000-00-00 00:00:00")), nil, nil)
+	AssertEqual(t, mySqlValue("TIME", []byte("-10:30:00")), "-10:30:00", nil)
+
+	value := mySqlValue("DATETIME", []byte("2020-03-15 10:30:00.5"))
+	AssertEqual(t, value.(time.Time).Format(time.RFC3339Nano), "2020-03-15T10:30:00.5Z", nil)
+	value = mySqlValue("DATE", []byte("2020-03-15"))
+	AssertEqual(t, value.(time.Time).Format(time.RFC3339), "2020-03-15T00:00:00Z", nil)
+}
+
+//countingDriver counts the prepared statements and returns the first argument as row
+type countingDriver struct {
+	prepares int32
+}
+
+var counting = &countingDriver{}
+
+func init() {
+	sql.Register("eye_counting", counting)
+}
+
+func (o *countingDriver) Open(name string) (driver.Conn, error) {
+	return &countingConn{driver: o}, nil
+}
+
+type countingConn struct {
+	driver *countingDriver
+}
+
+func (o *countingConn) Prepare(query string) (driver.Stmt, error) {
+	atomic.AddInt32(&o.driver.prepares, 1)
+	return &countingStmt{}, nil
+}
+
+func (o *countingConn) Close() error {
+	return nil
+}
+
+func (o *countingConn) Begin() (driver.Tx, error) {
+	return nil, errors.New("Transactions are not supported")
+}
+
+type countingStmt struct {
+}
+
+func (o *countingStmt) Close() error {
+	return nil
+}
+
+func (o *countingStmt) NumInput() int {
+	return -1
+}
+
+func (o *countingStmt) Exec(args []driver.Value) (driver.Result, error) {
+	return nil, errors.New("Exec is not supported")
+}
+
+func (o *countingStmt) Query(args []driver.Value) (driver.Rows, error) {
+	return &countingRows{value: args[0]}, nil
+}
+
+type countingRows struct {
+	value driver.Value
+	done  bool
+}
+
+func (o *countingRows) Columns() []string {
+	return []string{"arg"}
+}
+
+func (o *countingRows) ColumnTypeDatabaseTypeName(index int) string {
+	return "BIGINT"
+}
+
+func (o *countingRows) Close() error {
+	return nil
+}
+
+func (o *countingRows) Next(dest []driver.Value) error {
+	if o.done {
+		return io.EOF
+	}
+	o.done = true
+	dest[0] = o.value
+	return nil
+}
+
+func TestMySqlPreparedStatements(t *testing.T) {
+	prepares := atomic.LoadInt32(&counting.prepares)
+	db, _ := sql.Open("eye_counting", "")
+	service := &MySqlService{mysql: &MySql{Name: "mysql"}, db: db}
+	defer service.Close()
+
+	for i := 0; i < 3; i++ {
+		rows, err := service.queryMaps("SELECT ? AS arg", "42")
+		AssertEqual(t, err, nil, ErrorMessageBuilder)
+		AssertEqual(t, rows[0]["arg"], int64(42), nil)
+	}
+	AssertEqual(t, atomic.LoadInt32(&counting.prepares)-prepares, int32(1), nil)
+	AssertEqual(t, len(service.stmts), 1, nil)
+
+	//a statement in use is closed after its release, when it is evicted
+	inUse, err := service.prepare("SELECT ? AS used")
+	AssertEqual(t, err, nil, ErrorMessageBuilder)
+	for i := 0; i < maxCachedStatements; i++ {
+		_, err = service.queryMaps(fmt.Sprintf("SELECT ? AS arg%v", i), "42")
+		AssertEqual(t, err, nil, ErrorMessageBuilder)
+	}
+	AssertEqual(t, len(service.stmts), maxCachedStatements, nil)
+	AssertEqual(t, inUse.evicted, true, nil)
+	AssertEqual(t, inUse.stmt != nil, true, nil)
+	rows, err := inUse.stmt.Query("42")
+	AssertEqual(t, err, nil, ErrorMessageBuilder)
+	rows.Close()
+	service.release(inUse)
+	AssertEqual(t, inUse.stmt == nil, true, nil)
+
+	//the least recently used statement is evicted
+	_, cached := service.stmts["SELECT ? AS arg"]
+	AssertEqual(t, cached, false, nil)
+	_, cached = service.stmts["SELECT ? AS arg0"]
+	AssertEqual(t, cached, true, nil)
+}
+
+func TestMySqlPool(t *testing.T) {
+	service := &MySqlService{mysql: &MySql{Name: "pool", Host: "db", Port: 3306, Database: "app",
+		Params: map[string]string{"charset": "utf8mb4", "timeout": "5s"}, Tls: &Tls{ServerName: "db"}}}
+	dataSource, err := service.dataSource(as.Access{User: "eye", Password: "secret"})
+	AssertEqual(t, err, nil, ErrorMessageBuilder)
+	AssertEqual(t, dataSource, "eye:secret@tcp(db:3306)/app?charset=utf8mb4&timeout=5s&tls=eye_pool", nil)
+
+	//lists of the driver are not escaped, system variables and the location are unescaped by the driver
+	service.mysql.Params = map[string]string{"charset": "utf8mb4,utf8", "loc": "Europe/Berlin",
+		"sql_mode": "'ANSI_QUOTES'"}
+	service.mysql.Tls = nil
+	dataSource, err = service.dataSource(as.Access{User: "eye", Password: "secret"})
+	AssertEqual(t, err, nil, ErrorMessageBuilder)
+	AssertEqual(t, dataSource,
+		"eye:secret@tcp(db:3306)/app?charset=utf8mb4,utf8&loc=Europe%2FBerlin&sql_mode=%27ANSI_QUOTES%27", nil)
+	config, err := mysql.ParseDSN(dataSource)
+	AssertEqual(t, err, nil, ErrorMessageBuilder)
+	AssertEqual(t, config.Loc.String(), "Europe/Berlin", nil)
+	AssertEqual(t, config.Params["sql_mode"], "'ANSI_QUOTES'", nil)
+	AssertEqual(t, config.Params["charset"], "utf8mb4,utf8", nil)
+
+	AssertEqual(t, service.poolStats()["initialized"], false, nil)
+	service.db, _ = sql.Open("eye_counting", "")
+	defer service.Close()
+	service.configurePool()
+	_, err = service.queryMaps("SELECT ?", 1)
+	AssertEqual(t, err, nil, ErrorMessageBuilder)
+
+	stats := service.poolStats()
+	AssertEqual(t, stats["max_open_connections"], defaultMaxOpenConns, nil)
+	AssertEqual(t, stats["open_connections"], 1, nil)
+	AssertEqual(t, stats["cached_statements"], 1, nil)
+
+	check, err := service.NewСheck(&ValidationRequest{Kind: MySqlPool, EvalExpr: "open_connections >= 1", All: true})
+	AssertEqual(t, err, nil, ErrorMessageBuilder)
+	AssertEqual(t, check.Validate(), nil, ErrorMessageBuilder)
+}
@@ -0,0 +1,361 @@
+package core
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	ParamString = "string"
+	ParamInt    = "int"
+	ParamFloat  = "float"
+	ParamBool   = "bool"
+	ParamDate   = "date"
+	ParamTime   = "time"
+)
+
+const (
+	LayoutUnix       = "unix"
+	LayoutUnixMillis = "unixms"
+	LayoutDate       = "date"
+	LayoutDateTime   = "datetime"
+	LayoutRfc3339    = "rfc3339"
+)
+
+var placeHolderPattern = regexp.MustCompile("@@([a-zA-Z0-9_]+)@@")
+
+//timePlaceHolderPattern matches @@NOW@@, @@TODAY@@ with optional offsets and layout, e.g. @@NOW-10m|unix@@
+var timePlaceHolderPattern = regexp.MustCompile(`@@(?i:(NOW|TODAY)((?:[+-][0-9]+(?:ms|s|m|h|d|w))*)(?:\|([^@]+))?)@@`)
+
+var sqlPlaceHolderPattern = regexp.MustCompile(placeHolderPattern.String() + "|" + timePlaceHolderPattern.String())
+
+var timeOffsetPattern = regexp.MustCompile(`(?i)([+-][0-9]+)(ms|s|m|h|d|w)`)
+
+var timeLayouts = map[string]string{
+	LayoutDate:     "2006-01-02",
+	LayoutDateTime: "2006-01-02 15:04:05",
+	LayoutRfc3339:  time.RFC3339,
+}
+
+// Param declares a named parameter of an export, the value is available as @@NAME@@ in the query.
+type Param struct {
+	Name string
+	//string (default), int, float, bool, date (2006-01-02) or time (RFC3339)
+	Type     string
+	Default  string
+	Required bool
+	//regular expression the whole value must match
+	Pattern string
+}
+
+func (o *Param) validate(value string) (err error) {
+	switch strings.ToLower(o.Type) {
+	case "", ParamString:
+	case ParamInt:
+		_, err = strconv.ParseInt(value, 10, 64)
+	case ParamFloat:
+		_, err = strconv.ParseFloat(value, 64)
+	case ParamBool:
+		_, err = strconv.ParseBool(value)
+	case ParamDate:
+		_, err = time.Parse("2006-01-02", value)
+	case ParamTime:
+		_, err = time.Parse(time.RFC3339, value)
+	default:
+		return errors.New(fmt.Sprintf("The type '%v' of the parameter '%v' is not supported", o.Type, o.Name))
+	}
+	if err != nil {
+		return errors.New(fmt.Sprintf("The value '%v' of the parameter '%v' is not a valid %v", value, o.Name, o.Type))
+	}
+
+	if len(o.Pattern) > 0 {
+		var matched bool
+		if matched, err = regexp.MatchString(fmt.Sprintf("^(?:%v)$", o.Pattern), value); err == nil && !matched {
+			err = errors.New(fmt.Sprintf("The value '%v' of the parameter '%v' does not match '%v'",
+				value, o.Name, o.Pattern))
+		}
+	}
+	return
+}
+
+// validateParams checks the params against the declared ones and fills the defaults.
+// Without declared params, the params are passed as they are.
+func validateParams(declared []*Param, params map[string]string) (ret map[string]string, err error) {
+	if len(declared) == 0 {
+		return params, nil
+	}
+
+	values := make(map[*Param]string, len(params))
+	for name, value := range params {
+		if param := findParam(declared, name); param != nil {
+			values[param] = value
+		} else {
+			err = errors.New(fmt.Sprintf("The parameter '%v' is unknown, allowed are: %v",
+				name, strings.Join(paramNames(declared), ", ")))
+			return
+		}
+	}
+
+	ret = make(map[string]string, len(declared))
+	for _, param := range declared {
+		value := values[param]
+		if len(value) == 0 {
+			value = param.Default
+		}
+		if len(value) == 0 {
+			if param.Required {
+				err = errors.New(fmt.Sprintf("The parameter '%v' is required", param.Name))
+				return
+			}
+			continue
+		}
+		if err = param.validate(value); err != nil {
+			return
+		}
+		ret[param.Name] = value
+	}
+	return
+}
+
+func findParam(declared []*Param, name string) *Param {
+	for _, param := range declared {
+		if strings.EqualFold(param.Name, name) {
+			return param
+		}
+	}
+	return nil
+}
+
+func paramNames(declared []*Param) (ret []string) {
+	ret = make([]string, len(declared))
+	for i, param := range declared {
+		ret[i] = param.Name
+	}
+	return
+}
+
+func sortedParamValues(params map[string]string) (ret []string) {
+	keys := make([]string, 0, len(params))
+	for k := range params {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	ret = make([]string, len(keys))
+	for i, k := range keys {
+		ret[i] = params[k]
+	}
+	return
+}
+
+// prepareSqlQuery replaces the @@NAME@@ and the time placeholders by '?' and returns the values as bound arguments.
+// The time placeholders are formatted as 'datetime' by default.
+func prepareSqlQuery(query string, params map[string]string) (ret string, args []interface{}, err error) {
+	return bindSqlQuery(query, params, nil)
+}
+
+// bindSqlQuery binds the '?' parameters of the query to the positional values and replaces the @@NAME@@ and
+// the time placeholders by '?', the arguments are in the order of their occurrence.
+func bindSqlQuery(query string, params map[string]string, positional []interface{}) (ret string, args []interface{},
+	err error) {
+
+	var tokens []*sqlToken
+	if strings.Contains(query, "?") || strings.Contains(query, "@@") {
+		if tokens, err = lexSql(query); err != nil {
+			return
+		}
+	}
+	questionMarks := sqlTokenQuestionMarks(tokens)
+	if len(questionMarks) != len(positional) {
+		err = errors.New(fmt.Sprintf("The query '%v' has %v '?' parameters, but %v values are given",
+			query, len(questionMarks), len(positional)))
+		return
+	}
+
+	values := make(map[string]string, len(params))
+	for k, v := range params {
+		values[strings.ToUpper(k)] = v
+	}
+
+	now := time.Now()
+	var buffer bytes.Buffer
+	pos := 0
+	placeHolders := sqlPlaceHolders(query, tokens)
+	for len(questionMarks) > 0 || len(placeHolders) > 0 {
+		if len(placeHolders) == 0 || (len(questionMarks) > 0 && questionMarks[0] < placeHolders[0][0]) {
+			buffer.WriteString(query[pos : questionMarks[0]+1])
+			pos = questionMarks[0] + 1
+			args = append(args, positional[0])
+			questionMarks, positional = questionMarks[1:], positional[1:]
+			continue
+		}
+
+		start, end := placeHolders[0][0], placeHolders[0][1]
+		placeHolders = placeHolders[1:]
+		placeHolder := query[start:end]
+		buffer.WriteString(query[pos:start])
+		pos = end
+		name := strings.ToUpper(placeHolder[2 : len(placeHolder)-2])
+		if value, ok := values[name]; ok {
+			args = append(args, value)
+			buffer.WriteString("?")
+		} else if value, ok := formatTimePlaceHolder(placeHolder, now, LayoutDateTime); ok {
+			args = append(args, value)
+			buffer.WriteString("?")
+		} else {
+			err = errors.New(fmt.Sprintf("No value for the parameter '%v' of the query '%v'", name, query))
+			return
+		}
+	}
+	buffer.WriteString(query[pos:])
+	ret = buffer.String()
+	return
+}
+
+//sqlQuestionMarks returns the positions of the '?' parameters, outside of quoted texts and comments
+func sqlQuestionMarks(query string) (ret []int, err error) {
+	if !strings.Contains(query, "?") {
+		return
+	}
+	var tokens []*sqlToken
+	if tokens, err = lexSql(query); err == nil {
+		ret = sqlTokenQuestionMarks(tokens)
+	}
+	return
+}
+
+func sqlTokenQuestionMarks(tokens []*sqlToken) (ret []int) {
+	for _, token := range tokens {
+		if token.is(sqlSymbol, "?") {
+			ret = append(ret, token.start)
+		}
+	}
+	return
+}
+
+//sqlPlaceHolders returns the start and end of the @@NAME@@ and time placeholders, outside of quoted texts and comments
+func sqlPlaceHolders(query string, tokens []*sqlToken) (ret [][]int) {
+	starts := make(map[int]bool)
+	for _, token := range tokens {
+		if token.is(sqlSymbol, "@") {
+			starts[token.start] = true
+		}
+	}
+	for _, placeHolder := range sqlPlaceHolderPattern.FindAllStringIndex(query, -1) {
+		if starts[placeHolder[0]] {
+			ret = append(ret, placeHolder)
+		}
+	}
+	return
+}
+
+// positionalValues returns the values of the declared params in the order of declaration, typed by the param type
+func positionalValues(declared []*Param, params map[string]string) (ret []interface{}) {
+	ret = make([]interface{}, len(declared))
+	for i, param := range declared {
+		if value, ok := params[param.Name]; ok {
+			ret[i] = param.typed(value)
+		}
+	}
+	return
+}
+
+// argValues returns the values of the '?' parameters of checks, time placeholders are evaluated, e.g. '@@NOW-1h@@'
+func argValues(args []string) (ret []interface{}) {
+	now := time.Now()
+	ret = make([]interface{}, len(args))
+	for i, arg := range args {
+		if value, ok := formatTimePlaceHolder(arg, now, LayoutDateTime); ok {
+			ret[i] = value
+		} else {
+			ret[i] = arg
+		}
+	}
+	return
+}
+
+//typed converts the validated value to int64, float64 or bool by the type of the param
+func (o *Param) typed(value string) (ret interface{}) {
+	ret = value
+	switch strings.ToLower(o.Type) {
+	case ParamInt:
+		if number, err := strconv.ParseInt(value, 10, 64); err == nil {
+			ret = number
+		}
+	case ParamFloat:
+		if number, err := strconv.ParseFloat(value, 64); err == nil {
+			ret = number
+		}
+	case ParamBool:
+		if flag, err := strconv.ParseBool(value); err == nil {
+			ret = flag
+		}
+	}
+	return
+}
+
+// replaceTimePlaceHolders replaces @@NOW@@ and @@TODAY@@ by the current time or the start of the day,
+// optionally with offsets, e.g. @@NOW-10m@@ or @@TODAY-1d@@, and a layout, e.g. @@NOW|2006-01-02@@.
+// Supported offset units are ms, s, m, h, d and w; layouts are Go time layouts, unix, unixms, date,
+// datetime and rfc3339 (default). The escape function is applied to the formatted values, if set.
+func replaceTimePlaceHolders(query string, defaultLayout string, escape func(string) string) string {
+	now := time.Now()
+	return timePlaceHolderPattern.ReplaceAllStringFunc(query, func(placeHolder string) string {
+		value, _ := formatTimePlaceHolder(placeHolder, now, defaultLayout)
+		if escape != nil {
+			value = escape(value)
+		}
+		return value
+	})
+}
+
+func formatTimePlaceHolder(placeHolder string, now time.Time, defaultLayout string) (ret string, ok bool) {
+	match := timePlaceHolderPattern.FindStringSubmatch(placeHolder)
+	if ok = match != nil && len(match[0]) == len(placeHolder); !ok {
+		return
+	}
+
+	value := now
+	if strings.EqualFold(match[1], "TODAY") {
+		value = time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	}
+	for _, offset := range timeOffsetPattern.FindAllStringSubmatch(match[2], -1) {
+		amount, _ := strconv.Atoi(offset[1])
+		switch strings.ToLower(offset[2]) {
+		case "ms":
+			value = value.Add(time.Duration(amount) * time.Millisecond)
+		case "s":
+			value = value.Add(time.Duration(amount) * time.Second)
+		case "m":
+			value = value.Add(time.Duration(amount) * time.Minute)
+		case "h":
+			value = value.Add(time.Duration(amount) * time.Hour)
+		case "d":
+			value = value.AddDate(0, 0, amount)
+		case "w":
+			value = value.AddDate(0, 0, 7*amount)
+		}
+	}
+
+	layout := match[3]
+	if len(layout) == 0 {
+		layout = defaultLayout
+	}
+	switch strings.ToLower(layout) {
+	case LayoutUnix:
+		ret = strconv.FormatInt(value.Unix(), 10)
+	case LayoutUnixMillis:
+		ret = strconv.FormatInt(value.UnixNano()/int64(time.Millisecond), 10)
+	default:
+		if predefined, ok := timeLayouts[strings.ToLower(layout)]; ok {
+			layout = predefined
+		}
+		ret = value.Format(layout)
+	}
+	return
+}
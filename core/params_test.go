@@ -0,0 +1,126 @@
+package core
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestValidateParams(t *testing.T) {
+	declared := []*Param{
+		{Name: "day", Type: ParamDate, Required: true},
+		{Name: "limit", Type: ParamInt, Default: "10"},
+		{Name: "host", Pattern: "[a-z0-9.-]+"},
+	}
+
+	params, err := validateParams(declared, map[string]string{"DAY": "2017-11-20"})
+	AssertEqual(t, err, nil, ErrorMessageBuilder)
+	AssertEqual(t, params["day"], "2017-11-20", nil)
+	AssertEqual(t, params["limit"], "10", nil)
+
+	_, err = validateParams(declared, map[string]string{"limit": "5"})
+	AssertEqual(t, err != nil, true, nil)
+
+	_, err = validateParams(declared, map[string]string{"day": "20.11.2017"})
+	AssertEqual(t, err != nil, true, nil)
+
+	_, err = validateParams(declared, map[string]string{"day": "2017-11-20", "host": "a b"})
+	AssertEqual(t, err != nil, true, nil)
+
+	_, err = validateParams(declared, map[string]string{"day": "2017-11-20", "unknown": "1"})
+	AssertEqual(t, err != nil, true, nil)
+}
+
+func TestPrepareSqlQuery(t *testing.T) {
+	query, args, err := prepareSqlQuery("SELECT * FROM log WHERE day = @@DAY@@ AND host = @@host@@",
+		map[string]string{"day": "2017-11-20", "host": "a"})
+	AssertEqual(t, err, nil, ErrorMessageBuilder)
+	AssertEqual(t, query, "SELECT * FROM log WHERE day = ? AND host = ?", nil)
+	AssertEqual(t, len(args), 2, nil)
+	AssertEqual(t, args[1], "a", nil)
+
+	_, _, err = prepareSqlQuery("SELECT * FROM log WHERE day = @@DAY@@", nil)
+	AssertEqual(t, err != nil, true, nil)
+}
+
+func TestPrepareQueryEscape(t *testing.T) {
+	query := prepareQuery(`{"query": {"term": {"host": "@@HOST@@"}}}`,
+		map[string]string{"host": `a"}}, "size": 10000, "x": {"y": "`}, jsonEscape)
+	AssertEqual(t, query, `{"query": {"term": {"host": "a\"}}, \"size\": 10000, \"x\": {\"y\": \""}}}`, nil)
+
+	AssertEqual(t, prepareQuery("/logs/@@DAY@@", map[string]string{"day": "2017-11-20"}, nil), "/logs/2017-11-20", nil)
+}
+
+func TestTimePlaceHolders(t *testing.T) {
+	now := time.Date(2020, 3, 15, 10, 30, 0, 0, time.UTC)
+
+	for placeHolder, expected := range map[string]string{
+		"@@NOW@@":                  "2020-03-15T10:30:00Z",
+		"@@now-10m@@":              "2020-03-15T10:20:00Z",
+		"@@NOW+1h-30s@@":           "2020-03-15T11:29:30Z",
+		"@@TODAY@@":                "2020-03-15T00:00:00Z",
+		"@@TODAY-1d|date@@":        "2020-03-14",
+		"@@NOW-1w|datetime@@":      "2020-03-08 10:30:00",
+		"@@NOW|unix@@":             "1584268200",
+		"@@NOW-1s|unixms@@":        "1584268199000",
+		"@@NOW|2006/01/02 15:04@@": "2020/03/15 10:30",
+	} {
+		value, ok := formatTimePlaceHolder(placeHolder, now, LayoutRfc3339)
+		AssertEqual(t, ok, true, nil)
+		AssertEqual(t, value, expected, nil)
+	}
+
+	_, ok := formatTimePlaceHolder("@@NOW-10x@@", now, LayoutRfc3339)
+	AssertEqual(t, ok, false, nil)
+
+	query := replaceTimePlaceHolders("/logs?from=@@NOW-10m@@", LayoutRfc3339, url.QueryEscape)
+	AssertEqual(t, strings.Contains(query, "@@"), false, nil)
+	AssertEqual(t, strings.Contains(query, "%3A"), true, nil)
+}
+
+func TestSqlQueryTimePlaceHolders(t *testing.T) {
+	query, args, err := prepareSqlQuery(
+		"SELECT count(*) AS c FROM events WHERE type = @@TYPE@@ AND created > @@NOW-10m@@ AND @@version IS NOT NULL",
+		map[string]string{"type": "error"})
+	AssertEqual(t, err, nil, ErrorMessageBuilder)
+	AssertEqual(t, query, "SELECT count(*) AS c FROM events WHERE type = ? AND created > ? AND @@version IS NOT NULL", nil)
+	AssertEqual(t, len(args), 2, nil)
+	AssertEqual(t, args[0], "error", nil)
+
+	_, err = time.ParseInLocation("2006-01-02 15:04:05", args[1].(string), time.Local)
+	AssertEqual(t, err, nil, ErrorMessageBuilder)
+}
+
+func TestBindSqlQuery(t *testing.T) {
+	query, args, err := bindSqlQuery(
+		"SELECT '?', `a?` FROM log WHERE day = ? AND host = @@HOST@@ -- why?\nAND level > ? AND t > @@NOW-1h@@",
+		map[string]string{"host": "a"}, []interface{}{"2017-11-20", int64(3)})
+	AssertEqual(t, err, nil, ErrorMessageBuilder)
+	AssertEqual(t, query, "SELECT '?', `a?` FROM log WHERE day = ? AND host = ? -- why?\nAND level > ? AND t > ?", nil)
+	AssertEqual(t, len(args), 4, nil)
+	AssertEqual(t, args[0], "2017-11-20", nil)
+	AssertEqual(t, args[1], "a", nil)
+	AssertEqual(t, args[2], int64(3), nil)
+
+	query, args, err = bindSqlQuery("SELECT '@@DAY@@' AS d, `@@DAY@@` FROM log /* @@DAY@@ */ WHERE day = @@DAY@@ "+
+		"-- @@NOW@@\nAND t > @@NOW-1h@@ # @@TODAY@@", map[string]string{"day": "2017-11-20"}, nil)
+	AssertEqual(t, err, nil, ErrorMessageBuilder)
+	AssertEqual(t, query, "SELECT '@@DAY@@' AS d, `@@DAY@@` FROM log /* @@DAY@@ */ WHERE day = ? "+
+		"-- @@NOW@@\nAND t > ? # @@TODAY@@", nil)
+	AssertEqual(t, len(args), 2, nil)
+	AssertEqual(t, args[0], "2017-11-20", nil)
+
+	_, _, err = bindSqlQuery("SELECT * FROM log WHERE day = ?", nil, nil)
+	AssertEqual(t, err != nil, true, nil)
+
+	declared := []*Param{{Name: "day", Type: ParamDate}, {Name: "level", Type: ParamInt}, {Name: "host"}}
+	values := positionalValues(declared, map[string]string{"day": "2017-11-20", "level": "3"})
+	AssertEqual(t, values[0], "2017-11-20", nil)
+	AssertEqual(t, values[1], int64(3), nil)
+	AssertEqual(t, values[2], nil, nil)
+
+	values = argValues([]string{"abc", "@@TODAY|date@@"})
+	AssertEqual(t, values[0], "abc", nil)
+	AssertEqual(t, values[1], time.Now().Format("2006-01-02"), nil)
+}
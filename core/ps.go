@@ -71,7 +71,12 @@ func (o *PsService) newСheck(req *ValidationRequest) (ret *PsCheck, err error)
 		return
 	}
 
-	ret = &PsCheck{info: req.CheckKey("Ps"), service: o, eval: eval, all: req.All}
+	var aggr *aggregation
+	if aggr, err = compileAggr(req.AggrExpr); err != nil {
+		return
+	}
+
+	ret = &PsCheck{info: req.CheckKey("Ps"), service: o, eval: eval, all: req.All, aggr: aggr}
 	return
 }
 
@@ -143,6 +148,7 @@ type PsCheck struct {
 	service *PsService
 	all     bool
 	eval    *govaluate.EvaluableExpression
+	aggr    *aggregation
 }
 
 func (o *PsCheck) Info() string {
@@ -150,7 +156,7 @@ func (o *PsCheck) Info() string {
 }
 
 func (o *PsCheck) Validate() (err error) {
-	return validate(o, o.eval, o.all)
+	return validate(o, o.eval, o.all, o.aggr)
 }
 
 func (o *PsCheck) Query() (ret QueryResults, err error) {
@@ -195,7 +201,7 @@ func (o *psExporter) Export(params map[string]string) (err error) {
 	if out, err = o.req.CreateOut(params); err != nil {
 		return
 	}
-	defer out.Close()
+	defer closeExportOut(out, &err)
 
 	err = o.service.queryToWriter(&eio.WriteCloserMapWriter{Convert: o.req.Convert, Out: out})
 	return
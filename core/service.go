@@ -1,6 +1,7 @@
 package core
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"errors"
@@ -67,8 +68,40 @@ type Factory interface {
 type ValidationRequest struct {
 	Query    string
 	RegExpr  string
+	JsonPath string
 	EvalExpr string
 	All      bool
+	//mysql: row limit of select queries, default 5, -1 for no limit; a bound LIMIT (e.g. "LIMIT ?") is capped by an outer select
+	Limit int
+	//mysql: values of the '?' parameters of the query, time placeholders are evaluated, e.g. '@@NOW-1h@@'
+	Args []string
+	//evaluated once for the whole result, e.g. 'count() >= 3 && max(Seconds_Behind_Master) < 30'
+	AggrExpr string
+
+	//compare: rows of the services are joined by the key fields instead of their position,
+	//'Missing_N' is true, if the service N has no row for the key
+	JoinKeys []string
+	//compare: all services must have equal values of the fields
+	EqualFields []string
+	//compare: tolerance per field ('*' for all fields), parts separated by '+': absolute difference '5',
+	//relative difference '0.1%', time skew '30s', normalisation 'trim', 'lower' and 'round' or 'round2'
+	Tolerances map[string]string
+
+	//fs: recursive listing by glob, depth, excludes and file count cap
+	Listing *FileListing
+
+	//elastic: search (default), count, aggs, cat, api (only _cat, _cluster and _nodes), health, indices or nodes;
+	//mysql: query (default), schema (query is the schema, default the database), checksum (query are the tables),
+	//replica, galera, processlist (query is the long running threshold, e.g. '30s'), innodb, connections or pool
+	Kind string
+
+	//http: request method (default GET), headers, query parameters and body template (Go text/template),
+	//only by configured checks, the API does not pass them
+	Method      string
+	Headers     map[string]string
+	QueryParams map[string]string
+	Body        string
+	ContentType string
 }
 
 func NewValidationRequest(query string, evalExp string) *ValidationRequest {
@@ -77,7 +110,11 @@ func NewValidationRequest(query string, evalExp string) *ValidationRequest {
 
 type ExportRequest struct {
 	Query     string
+	//declared params, the values are bound to the '?' parameters of the query in this order
+	Params    []*Param
 	EvalExpr  string
+	//fs: recursive listing by glob, depth, excludes and file count cap
+	Listing   *FileListing
 	Convert   func(map[string]interface{}) (io.Reader, error)
 	CreateOut func(params map[string]string) (io.WriteCloser, error)
 }
@@ -87,25 +124,57 @@ type CommandRequest struct {
 
 func (o *ValidationRequest) CheckKey(serviceName string) string {
 	if o.All {
-		return fmt.Sprintf("%v.q(%v).e(%v).all[eval(%v)]",
-			serviceName, o.Query, o.RegExpr, o.EvalExpr)
+		return fmt.Sprintf("%v.q(%v).e(%v)%v.all[eval(%v)]",
+			serviceName, o.Query, o.RegExpr, o.optionsKey(), o.EvalExpr)
 	} else {
-		return fmt.Sprintf("%v.q(%v).e(%v).any[eval(%v)]",
-			serviceName, o.Query, o.RegExpr, o.EvalExpr)
+		return fmt.Sprintf("%v.q(%v).e(%v)%v.any[eval(%v)]",
+			serviceName, o.Query, o.RegExpr, o.optionsKey(), o.EvalExpr)
 	}
 }
 
 func (o *ValidationRequest) ChecksKey(strictness string, serviceNames []string) string {
 	if o.All {
-		return fmt.Sprintf("%v(%v.q(%v).e(%v).eval(%v))", strictness,
-			strings.Join(serviceNames, "-"), o.Query, o.RegExpr, o.EvalExpr)
+		return fmt.Sprintf("%v(%v.q(%v).e(%v)%v.eval(%v))", strictness,
+			strings.Join(serviceNames, "-"), o.Query, o.RegExpr, o.optionsKey(), o.EvalExpr)
 	} else {
-		return fmt.Sprintf("%v(%v.q(%v).e(%v).eval(%v))", strictness,
-			strings.Join(serviceNames, "-"), o.Query, o.RegExpr, o.EvalExpr)
+		return fmt.Sprintf("%v(%v.q(%v).e(%v)%v.eval(%v))", strictness,
+			strings.Join(serviceNames, "-"), o.Query, o.RegExpr, o.optionsKey(), o.EvalExpr)
 	}
 
 }
 
+func (o *ValidationRequest) optionsKey() (ret string) {
+	if len(o.Kind) > 0 {
+		ret += fmt.Sprintf(".k(%v)", o.Kind)
+	}
+	if o.Limit != 0 {
+		ret += fmt.Sprintf(".l(%v)", o.Limit)
+	}
+	if len(o.Args) > 0 {
+		ret += fmt.Sprintf(".args(%v)", strings.Join(o.Args, ","))
+	}
+	if len(o.AggrExpr) > 0 {
+		ret += fmt.Sprintf(".aggr(%v)", o.AggrExpr)
+	}
+	if len(o.JoinKeys) > 0 || len(o.EqualFields) > 0 {
+		ret += fmt.Sprintf(".join(%v).equal(%v)", strings.Join(o.JoinKeys, ","), strings.Join(o.EqualFields, ","))
+	}
+	if len(o.Tolerances) > 0 {
+		ret += fmt.Sprintf(".tolerance(%v)", o.Tolerances)
+	}
+	if o.Listing != nil {
+		ret += fmt.Sprintf(".files(%v,%v,%v,%v,%v)", o.Listing.Glob, o.Listing.MaxDepth,
+			strings.Join(o.Listing.Exclude, ","), o.Listing.FollowSymlinks, o.Listing.MaxFiles)
+	}
+	if len(o.JsonPath) > 0 {
+		ret += fmt.Sprintf(".j(%v)", o.JsonPath)
+	}
+	if len(o.Method) > 0 || len(o.Headers) > 0 || len(o.QueryParams) > 0 || len(o.Body) > 0 {
+		ret += fmt.Sprintf(".http(%v,%v,%v,%v,%v)", o.Method, o.Headers, o.QueryParams, o.ContentType, o.Body)
+	}
+	return
+}
+
 func (o *ExportRequest) ExportKey(serviceName string) string {
 	return fmt.Sprintf("%v.q(%v)", serviceName, o.Query)
 }
@@ -139,9 +208,13 @@ func (o *MapQueryResult) String() (ret string) {
 	return
 }
 
+const MissingField = "Missing"
+
 type CompositeQueryResult struct {
 	Splitter *regexp.Regexp
 	Data     []QueryResult
+	//values of the join keys, available without index
+	Keys map[string]interface{}
 }
 
 func NewCompositeQueryResult(separator string, data []QueryResult) (ret *CompositeQueryResult, err error) {
@@ -156,11 +229,18 @@ func buildSplitter(separator string) (ret *regexp.Regexp, err error) {
 }
 
 func (o *CompositeQueryResult) Get(name string) (ret interface{}, err error) {
+	if value, ok := o.Keys[name]; ok {
+		return value, nil
+	}
 	if key_index := o.Splitter.FindStringSubmatch(name); len(key_index) == 3 {
 		index, _ := strconv.Atoi(key_index[2])
 		if index > 0 && index <= len(o.Data) {
 			current := o.Data[index-1]
-			ret, err = current.Get(key_index[1])
+			if key_index[1] == MissingField {
+				ret = current == nil
+			} else if current != nil {
+				ret, err = current.Get(key_index[1])
+			}
 		} else {
 			err = errors.New(fmt.Sprintf("The composite key '%v'is not compatible with the available data, "+
 				"the index '%v' is not in range of '[1-%v]' composite ", name, index, len(o.Data)))
@@ -206,6 +286,52 @@ func ComposeQueryResults(separator string, results []QueryResults) (ret QueryRes
 
 }
 
+// JoinQueryResults joins the rows of the results by the values of the key fields (full outer join),
+// the rows are in the order of the first occurrence of their keys.
+func JoinQueryResults(separator string, keys []string, results []QueryResults) (ret QueryResults, err error) {
+	var splitter *regexp.Regexp
+	if splitter, err = buildSplitter(separator); err != nil {
+		return
+	}
+
+	joined := make(map[string]*CompositeQueryResult)
+	for y, items := range results {
+		for _, item := range items {
+			var keyValues map[string]interface{}
+			var key string
+			if key, keyValues, err = joinKey(item, keys); err != nil {
+				return
+			}
+			composite, ok := joined[key]
+			if !ok {
+				composite = &CompositeQueryResult{Splitter: splitter, Data: make([]QueryResult, len(results)),
+					Keys: keyValues}
+				joined[key] = composite
+				ret = append(ret, composite)
+			}
+			if composite.Data[y] == nil {
+				composite.Data[y] = item
+			} else {
+				Log.Debug("Duplicate key '%v' in the result %v, only the first row is joined", key, y+1)
+			}
+		}
+	}
+	return
+}
+
+func joinKey(item QueryResult, keys []string) (ret string, values map[string]interface{}, err error) {
+	values = make(map[string]interface{}, len(keys))
+	texts := make([]string, len(keys))
+	for i, key := range keys {
+		if values[key], err = item.Get(key); err != nil {
+			return
+		}
+		texts[i] = toText(values[key])
+	}
+	ret = strings.Join(texts, "|")
+	return
+}
+
 func TimeoutContext(timeout time.Duration) context.Context {
 	c, _ := context.WithTimeout(context.Background(), timeout)
 	return c
@@ -253,13 +379,66 @@ func compileRegExpr(pattern string) (ret *regexp.Regexp, err error) {
 
 func compileEval(evalExpr string) (ret *govaluate.EvaluableExpression, err error) {
 	if len(evalExpr) > 0 {
-		if ret, err = govaluate.NewEvaluableExpression(evalExpr); err != nil {
-			Log.Err("The compilation of evaluable expression '%v' failed because of '%'", evalExpr, err)
+		if ret, err = govaluate.NewEvaluableExpressionWithFunctions(bracketDottedNames(evalExpr),
+			evalFunctions); err != nil {
+			Log.Err("The compilation of evaluable expression '%v' failed because of '%v'", evalExpr, err)
 		}
 	}
 	return
 }
 
+// bracketDottedNames escapes dotted names as parameters, e.g. 'db.latencyMs < 200' as '[db.latencyMs] < 200',
+// because govaluate would evaluate them as accessor of the parameter 'db'. Strings, escaped names and method
+// calls are kept.
+func bracketDottedNames(evalExpr string) string {
+	var buffer bytes.Buffer
+	for pos := 0; pos < len(evalExpr); {
+		c := evalExpr[pos]
+		start := pos
+		switch {
+		case c == '"' || c == '\'' || c == '[':
+			end := c
+			if c == '[' {
+				end = ']'
+			}
+			for pos++; pos < len(evalExpr) && evalExpr[pos] != end; pos++ {
+				if evalExpr[pos] == '\\' && c != '[' {
+					pos++
+				}
+			}
+			pos++
+		case c >= '0' && c <= '9':
+			for pos < len(evalExpr) && (isNameChar(evalExpr[pos]) || evalExpr[pos] == '.') {
+				pos++
+			}
+		case isNameChar(c):
+			dotted := false
+			for pos < len(evalExpr) && isNameChar(evalExpr[pos]) {
+				pos++
+				if pos+1 < len(evalExpr) && evalExpr[pos] == '.' && isNameChar(evalExpr[pos+1]) {
+					dotted = true
+					pos++
+				}
+			}
+			if dotted && (pos >= len(evalExpr) || evalExpr[pos] != '(') {
+				buffer.WriteString("[" + evalExpr[start:pos] + "]")
+				continue
+			}
+		default:
+			pos++
+		}
+		if pos > len(evalExpr) {
+			pos = len(evalExpr)
+		}
+		buffer.WriteString(evalExpr[start:pos])
+	}
+	return buffer.String()
+}
+
+func isNameChar(c byte) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9') || c == '_'
+}
+
 func compilePatterns(pattern ...string) (ret []*regexp.Regexp, err error) {
 	ret = make([]*regexp.Regexp, len(pattern))
 	for _, p := range pattern {
@@ -277,15 +456,23 @@ func ChecksKey(strictness string, serviceNames []string) string {
 	return fmt.Sprintf("%v(%v)", strictness, strings.Join(serviceNames, "-"))
 }
 
-func validate(check Check, eval *govaluate.EvaluableExpression, all bool) (err error) {
+func validate(check Check, eval *govaluate.EvaluableExpression, all bool, aggr *aggregation) (err error) {
 	var items QueryResults
 	if items, err = check.Query(); err == nil {
-		err = validateData(items, eval, all, check.Info())
+		err = validateData(items, eval, all, aggr, check.Info())
 	}
 	return
 }
 
-func validateData(items QueryResults, eval *govaluate.EvaluableExpression, all bool, info string) (err error) {
+func validateData(items QueryResults, eval *govaluate.EvaluableExpression, all bool, aggr *aggregation,
+	info string) (err error) {
+	//an empty result may be valid for aggregations, e.g. 'count() == 0'
+	if aggr != nil {
+		if err = aggr.validate(items, info); err != nil || len(items) == 0 {
+			return
+		}
+	}
+
 	valid := true
 	if eval != nil && len(items) > 0 {
 		for _, item := range items {
@@ -315,13 +502,25 @@ func validateData(items QueryResults, eval *govaluate.EvaluableExpression, all b
 	return
 }
 
-func prepareQuery(query string, params map[string]string) (ret string) {
+// prepareQuery replaces the @@NAME@@ placeholders by the param values and the time placeholders,
+// the escape function is applied to the values, if set.
+func prepareQuery(query string, params map[string]string, escape func(string) string) (ret string) {
 	ret = query
 	if params != nil && len(params) > 0 {
 		for k, v := range params {
+			if escape != nil {
+				v = escape(v)
+			}
 			placeHolder := fmt.Sprintf("@@%v@@", strings.ToUpper(k))
 			ret = strings.Replace(ret, placeHolder, v, -1)
 		}
 	}
+	ret = replaceTimePlaceHolders(ret, LayoutRfc3339, escape)
 	return
 }
+
+//jsonEscape escapes the value for the use inside of a JSON string, e.g. '"' as '\"'
+func jsonEscape(value string) string {
+	data, _ := json.Marshal(value)
+	return string(data[1 : len(data)-1])
+}
@@ -46,7 +46,7 @@ func (o *Eye) buildServiceFactory() Factory {
 	}
 
 	for _, item := range o.config.Elastic {
-		serviceFactory.Add(&ElasticService{elastic: item})
+		serviceFactory.Add(&ElasticService{elastic: item, accessFinder: o.accessFinder})
 	}
 	return serviceFactory
 }
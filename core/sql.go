@@ -0,0 +1,236 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+//default row limit of select checks
+const DefaultQueryLimit = 5
+
+const (
+	sqlWord = iota
+	sqlNumber
+	sqlString
+	sqlIdentifier
+	sqlSymbol
+)
+
+type sqlToken struct {
+	kind  int
+	text  string
+	start int
+	end   int
+	//depth of the parentheses
+	depth int
+}
+
+func (o *sqlToken) is(kind int, text string) bool {
+	return o.kind == kind && strings.EqualFold(o.text, text)
+}
+
+//statements, which can be checked
+var readOnlyStatements = map[string]bool{"SELECT": true, "SHOW": true, "DESC": true, "DESCRIBE": true,
+	"EXPLAIN": true, "WITH": true}
+
+//reserved words of writing or locking statements and clauses, e.g. 'WITH ... DELETE', 'SELECT ... INTO OUTFILE',
+//'FOR UPDATE', 'EXPLAIN ANALYZE', and the function reading server files
+var writeSqlKeywords = map[string]bool{"INSERT": true, "UPDATE": true, "DELETE": true, "REPLACE": true,
+	"INTO": true, "DROP": true, "ALTER": true, "CREATE": true, "RENAME": true, "GRANT": true, "REVOKE": true,
+	"CALL": true, "LOAD": true, "LOCK": true, "UNLOCK": true, "ANALYZE": true, "KILL": true, "LOAD_FILE": true}
+
+//functions with the name of a write keyword, e.g. REPLACE(text, from, to)
+var sqlFunctionKeywords = map[string]bool{"REPLACE": true, "INSERT": true}
+
+// readOnlyQuery parses the query and guarantees a single read-only statement. The rows of selects are limited
+// by a LIMIT at the end of the statement, a greater LIMIT of the query is reduced; limit < 0 means no limit.
+func readOnlyQuery(query string, limit int) (ret string, err error) {
+	var tokens []*sqlToken
+	if tokens, err = lexSql(query); err != nil {
+		return
+	}
+
+	//a trailing ';' is allowed
+	if len(tokens) > 0 && tokens[len(tokens)-1].is(sqlSymbol, ";") {
+		tokens = tokens[:len(tokens)-1]
+	}
+	if len(tokens) == 0 {
+		err = errors.New("Query is empty")
+		return
+	}
+
+	first := strings.ToUpper(tokens[0].text)
+	if tokens[0].kind != sqlWord || !readOnlyStatements[first] {
+		err = errors.New("Only SELECT, SHOW, DESCRIBE, EXPLAIN and WITH queries allowed")
+		return
+	}
+
+	//SHOW statements are read-only, e.g. 'SHOW CREATE TABLE'
+	checkWrites := first != "SHOW"
+	for i, token := range tokens {
+		if token.is(sqlSymbol, ";") {
+			err = errors.New("Only a single statement is allowed")
+			return
+		}
+		if !checkWrites || token.kind != sqlWord {
+			continue
+		}
+		word := strings.ToUpper(token.text)
+		isFunction := i+1 < len(tokens) && tokens[i+1].is(sqlSymbol, "(")
+		if (writeSqlKeywords[word] && !(isFunction && sqlFunctionKeywords[word])) ||
+			(word == "SHARE" && i > 0 && tokens[i-1].is(sqlWord, "FOR")) {
+			err = errors.New(fmt.Sprintf("'%v' is not allowed in a read-only query", token.text))
+			return
+		}
+	}
+
+	//drop trailing comments and ';'
+	query = query[:tokens[len(tokens)-1].end]
+	if limit < 0 || !(first == "SELECT" || first == "WITH") {
+		return query, nil
+	}
+	return limitSql(query, tokens, limit)
+}
+
+//limitSql appends the limit, or reduces the LIMIT of the statement (outside of parentheses).
+//A bound LIMIT, e.g. 'LIMIT ?' or 'LIMIT @@N@@', is capped by an outer select of the statement.
+func limitSql(query string, tokens []*sqlToken, limit int) (ret string, err error) {
+	var limitToken *sqlToken
+	for i, token := range tokens {
+		if token.depth == 0 && token.is(sqlWord, "LIMIT") {
+			if limitParameter(tokens[i+1:]) {
+				ret = fmt.Sprintf("SELECT * FROM (%v) AS eye_limited LIMIT %v", query, limit)
+				return
+			}
+			if i+1 >= len(tokens) || tokens[i+1].kind != sqlNumber {
+				err = errors.New("The LIMIT of the query must be a number or a parameter")
+				return
+			}
+			//LIMIT offset, count
+			limitToken = tokens[i+1]
+			if i+3 < len(tokens) && tokens[i+2].is(sqlSymbol, ",") && tokens[i+3].kind == sqlNumber {
+				limitToken = tokens[i+3]
+			}
+		}
+	}
+	if limitToken == nil {
+		ret = fmt.Sprintf("%v LIMIT %v", query, limit)
+	} else if current, convErr := strconv.Atoi(limitToken.text); convErr == nil && current <= limit {
+		ret = query
+	} else {
+		ret = fmt.Sprintf("%v%v%v", query[:limitToken.start], limit, query[limitToken.end:])
+	}
+	return
+}
+
+//limitParameter returns true, if the count or offset of the LIMIT is a '?' or @@NAME@@ parameter
+func limitParameter(tokens []*sqlToken) bool {
+	for i := 0; i < len(tokens) && i < 3; i++ {
+		if tokens[i].is(sqlSymbol, "?") || tokens[i].is(sqlSymbol, "@") {
+			return true
+		}
+		if (i == 0 && tokens[i].kind != sqlNumber) ||
+			(i == 1 && !tokens[i].is(sqlSymbol, ",") && !tokens[i].is(sqlWord, "OFFSET")) {
+			return false
+		}
+	}
+	return false
+}
+
+//lexSql splits the query into tokens, comments are skipped; executable comments are not allowed
+func lexSql(query string) (ret []*sqlToken, err error) {
+	depth := 0
+	for pos := 0; pos < len(query); {
+		c := query[pos]
+		start := pos
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f':
+			pos++
+			continue
+		case c == '#' || (c == '-' && strings.HasPrefix(query[pos:], "--") &&
+			(pos+2 == len(query) || strings.IndexByte(" \t\r\n", query[pos+2]) >= 0)):
+			if end := strings.IndexByte(query[pos:], '\n'); end >= 0 {
+				pos += end + 1
+			} else {
+				pos = len(query)
+			}
+			continue
+		case c == '/' && strings.HasPrefix(query[pos:], "/*"):
+			if strings.HasPrefix(query[pos:], "/*!") || strings.HasPrefix(query[pos:], "/*+") {
+				err = errors.New("Executable comments and optimizer hints are not allowed")
+				return
+			}
+			end := strings.Index(query[pos+2:], "*/")
+			if end < 0 {
+				err = errors.New("Unterminated comment in the query")
+				return
+			}
+			pos += end + 4
+			continue
+		case c == '\'' || c == '"' || c == '`':
+			if pos, err = skipSqlQuoted(query, pos); err != nil {
+				return
+			}
+			kind := sqlString
+			if c == '`' {
+				kind = sqlIdentifier
+			}
+			ret = append(ret, &sqlToken{kind: kind, text: query[start:pos], start: start, end: pos, depth: depth})
+			continue
+		case c >= '0' && c <= '9':
+			for pos < len(query) && (isSqlWordChar(query[pos]) || query[pos] == '.') {
+				pos++
+			}
+			ret = append(ret, &sqlToken{kind: sqlNumber, text: query[start:pos], start: start, end: pos, depth: depth})
+			continue
+		case isSqlWordChar(c):
+			for pos < len(query) && isSqlWordChar(query[pos]) {
+				pos++
+			}
+			ret = append(ret, &sqlToken{kind: sqlWord, text: query[start:pos], start: start, end: pos, depth: depth})
+			continue
+		}
+
+		if c == ')' {
+			depth--
+		}
+		pos++
+		ret = append(ret, &sqlToken{kind: sqlSymbol, text: query[start:pos], start: start, end: pos, depth: depth})
+		if c == '(' {
+			depth++
+		}
+	}
+	if depth != 0 {
+		err = errors.New("Unbalanced parentheses in the query")
+	}
+	return
+}
+
+//skipSqlQuoted returns the position after the closing quote, quotes are escaped by doubling or backslash
+func skipSqlQuoted(query string, pos int) (ret int, err error) {
+	quote := query[pos]
+	for ret = pos + 1; ret < len(query); ret++ {
+		switch query[ret] {
+		case '\\':
+			if quote != '`' {
+				ret++
+			}
+		case quote:
+			if ret+1 < len(query) && query[ret+1] == quote {
+				ret++
+			} else {
+				ret++
+				return
+			}
+		}
+	}
+	err = errors.New("Unterminated quoted text in the query")
+	return
+}
+
+func isSqlWordChar(c byte) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9') || c == '_' || c == '$' ||
+		c >= 0x80
+}
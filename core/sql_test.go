@@ -0,0 +1,64 @@
+package core
+
+import (
+	"testing"
+)
+
+func TestReadOnlyQuery(t *testing.T) {
+	for _, item := range []struct {
+		query    string
+		limit    int
+		expected string
+	}{
+		{"SELECT 1 AS C1", 5, "SELECT 1 AS C1 LIMIT 5"},
+		{"select\tid\nfrom users;  -- all users", 5, "select\tid\nfrom users LIMIT 5"},
+		{"SELECT * FROM users LIMIT 3", 5, "SELECT * FROM users LIMIT 3"},
+		{"SELECT * FROM users LIMIT 100", 5, "SELECT * FROM users LIMIT 5"},
+		{"SELECT * FROM users LIMIT 10, 100 # page", 5, "SELECT * FROM users LIMIT 10, 5"},
+		{"SELECT * FROM users LIMIT 100 OFFSET 10", 5, "SELECT * FROM users LIMIT 5 OFFSET 10"},
+		{"SELECT * FROM (SELECT id FROM users LIMIT 100) u WHERE id IN (SELECT id FROM admins LIMIT 1)", 5,
+			"SELECT * FROM (SELECT id FROM users LIMIT 100) u WHERE id IN (SELECT id FROM admins LIMIT 1) LIMIT 5"},
+		{"SELECT id FROM a UNION SELECT id FROM b", 5, "SELECT id FROM a UNION SELECT id FROM b LIMIT 5"},
+		{"SELECT 'a;b', \"x -- y\", `update` FROM t", 5, "SELECT 'a;b', \"x -- y\", `update` FROM t LIMIT 5"},
+		{"SELECT REPLACE(name, 'a', 'b') FROM t WHERE d > '@@TODAY-1d@@'", 5,
+			"SELECT REPLACE(name, 'a', 'b') FROM t WHERE d > '@@TODAY-1d@@' LIMIT 5"},
+		{"WITH c AS (SELECT 1) SELECT * FROM c", 2, "WITH c AS (SELECT 1) SELECT * FROM c LIMIT 2"},
+		{"SELECT * FROM users", -1, "SELECT * FROM users"},
+		{"SHOW CREATE TABLE users;", 5, "SHOW CREATE TABLE users"},
+		{"SHOW SLAVE STATUS", 5, "SHOW SLAVE STATUS"},
+		{"SELECT 5--1", 5, "SELECT 5--1 LIMIT 5"},
+		{"SELECT * FROM users ORDER BY id LIMIT ?", 5,
+			"SELECT * FROM (SELECT * FROM users ORDER BY id LIMIT ?) AS eye_limited LIMIT 5"},
+		{"SELECT * FROM users LIMIT @@N@@;", 5, "SELECT * FROM (SELECT * FROM users LIMIT @@N@@) AS eye_limited LIMIT 5"},
+		{"SELECT * FROM users LIMIT 10, ?", 5, "SELECT * FROM (SELECT * FROM users LIMIT 10, ?) AS eye_limited LIMIT 5"},
+		{"SELECT * FROM users LIMIT ? OFFSET 10", -1, "SELECT * FROM users LIMIT ? OFFSET 10"},
+	} {
+		query, err := readOnlyQuery(item.query, item.limit)
+		AssertEqual(t, err, nil, ErrorMessageBuilder)
+		AssertEqual(t, query, item.expected, nil)
+	}
+
+	for _, query := range []string{
+		"",
+		" -- only a comment",
+		"DELETE FROM users",
+		"SELECT 1; DROP TABLE users",
+		"SELECT 1 -- x\n; DELETE FROM users",
+		"SELECT 1 /*! ; DROP TABLE users */",
+		"SELECT * FROM users\nUNION SELECT * INTO OUTFILE '/tmp/x' FROM users",
+		"SELECT * FROM users FOR UPDATE",
+		"SELECT * FROM users LOCK IN SHARE MODE",
+		"SELECT * FROM users FOR SHARE",
+		"WITH c AS (SELECT 1) DELETE FROM users",
+		"EXPLAIN ANALYZE SELECT * FROM users",
+		"SELECT LOAD_FILE('/etc/passwd')",
+		"SELECT 'unterminated",
+		"SELECT (1",
+		"SELECT * FROM users LIMIT id",
+	} {
+		_, err := readOnlyQuery(query, 5)
+		if err == nil {
+			t.Fatalf("'%v' should not be allowed", query)
+		}
+	}
+}
@@ -0,0 +1,337 @@
+package core
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/eugeis/gee/as"
+	"hash"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	TargetFolder = "folder"
+	TargetSpool  = "spool"
+	TargetHttp   = "http"
+	TargetS3     = "s3"
+)
+
+// ExportTarget is the destination of an export, by default the local ExportFolder.
+type ExportTarget struct {
+	//folder (default), spool, http or s3
+	Type string
+
+	//folder, spool: target folder, default is the ExportFolder
+	Folder string
+
+	//http: upload url, '@@FILE@@' is replaced by the export file name; s3: endpoint, e.g. http://localhost:9000
+	Url string
+	//http: PUT or POST, default PUT
+	Method      string
+	ContentType string
+
+	//http: basic auth; s3: User is the access key id and Password the secret key
+	AccessKey string
+
+	Bucket string
+	Region string
+	Prefix string
+
+	//http, s3: upload timeout, default 5 minutes
+	TimeoutMillis int
+}
+
+const defaultTargetTimeoutMillis = 5 * 60 * 1000
+
+//validate checks the target at config time, e.g. s3 uploads must not be signed with empty credentials
+func (o *ExportTarget) validate() (err error) {
+	if o == nil {
+		return
+	}
+	switch strings.ToLower(o.Type) {
+	case "", TargetFolder, TargetSpool:
+	case TargetHttp:
+		if len(o.Url) == 0 {
+			err = errors.New("The url of the http export target is missing")
+		}
+	case TargetS3:
+		if len(o.Url) == 0 || len(o.Bucket) == 0 {
+			err = errors.New("The url and the bucket of the s3 export target are required")
+		} else if len(o.AccessKey) == 0 {
+			err = errors.New("The access key of the s3 export target is required")
+		}
+	default:
+		err = errors.New(fmt.Sprintf("Export target type '%v' is not supported", o.Type))
+	}
+	return
+}
+
+func (o *ExportTarget) method() string {
+	if len(o.Method) > 0 {
+		return strings.ToUpper(o.Method)
+	}
+	return http.MethodPut
+}
+
+func (o *ExportTarget) region() string {
+	if len(o.Region) > 0 {
+		return o.Region
+	}
+	return "us-east-1"
+}
+
+func (o *ExportTarget) contentType() string {
+	if len(o.ContentType) > 0 {
+		return o.ContentType
+	}
+	return "application/octet-stream"
+}
+
+func (o *ExportTarget) client() *http.Client {
+	timeoutMillis := o.TimeoutMillis
+	if timeoutMillis <= 0 {
+		timeoutMillis = defaultTargetTimeoutMillis
+	}
+	return &http.Client{Timeout: time.Duration(timeoutMillis) * time.Millisecond}
+}
+
+func (o *Eye) createExportOut(target *ExportTarget, fileName string) (ret io.WriteCloser, err error) {
+	if target == nil {
+		return os.Create(filepath.Join(o.config.ExportFolder, fileName))
+	}
+	if err = target.validate(); err != nil {
+		return
+	}
+
+	folder := target.Folder
+	if len(folder) == 0 {
+		folder = o.config.ExportFolder
+	}
+
+	switch strings.ToLower(target.Type) {
+	case "", TargetFolder:
+		ret, err = os.Create(filepath.Join(folder, fileName))
+	case TargetSpool:
+		ret, err = newSpoolOut(folder, fileName)
+	case TargetHttp:
+		var access as.Access
+		if access, err = o.findTargetAccess(target); err == nil {
+			ret, err = newUploadOut(o.config.ExportFolder, func(body *os.File, size int64, payloadHash string) error {
+				return uploadHttp(target, access, fileName, body, size)
+			})
+		}
+	case TargetS3:
+		var access as.Access
+		if access, err = o.findTargetAccess(target); err == nil {
+			ret, err = newUploadOut(o.config.ExportFolder, func(body *os.File, size int64, payloadHash string) error {
+				return uploadS3(target, access, fileName, body, size, payloadHash)
+			})
+		}
+	default:
+		err = errors.New(fmt.Sprintf("Export target type '%v' is not supported", target.Type))
+	}
+	return
+}
+
+func (o *Eye) findTargetAccess(target *ExportTarget) (ret as.Access, err error) {
+	if len(target.AccessKey) > 0 {
+		ret, err = o.accessFinder.FindAccess(target.AccessKey)
+	}
+	return
+}
+
+// closeExportOut closes the out, or aborts it when the export failed, so that
+// incomplete exports are neither renamed nor uploaded.
+func closeExportOut(out io.WriteCloser, err *error) {
+	if *err != nil {
+		if aborter, ok := out.(interface {
+			Abort() error
+		}); ok {
+			if abortErr := aborter.Abort(); abortErr != nil {
+				Log.Debug("Abort of export out failed because of %v", abortErr)
+			}
+			return
+		}
+	}
+	if closeErr := out.Close(); *err == nil {
+		*err = closeErr
+	}
+}
+
+//spoolOut writes to a '.part' file and renames it atomically on close
+type spoolOut struct {
+	*os.File
+	target string
+}
+
+func newSpoolOut(folder string, fileName string) (ret *spoolOut, err error) {
+	if err = os.MkdirAll(folder, 0777); err != nil {
+		return
+	}
+	target := filepath.Join(folder, fileName)
+	var file *os.File
+	if file, err = os.Create(target + ".part"); err == nil {
+		ret = &spoolOut{File: file, target: target}
+	}
+	return
+}
+
+func (o *spoolOut) Close() (err error) {
+	if err = o.File.Close(); err == nil {
+		err = os.Rename(o.File.Name(), o.target)
+	} else {
+		os.Remove(o.File.Name())
+	}
+	return
+}
+
+func (o *spoolOut) Abort() (err error) {
+	o.File.Close()
+	return os.Remove(o.File.Name())
+}
+
+//uploadOut buffers the export in a temporary file and uploads it on close
+type uploadOut struct {
+	file   *os.File
+	hash   hash.Hash
+	size   int64
+	upload func(body *os.File, size int64, payloadHash string) error
+}
+
+func newUploadOut(tempFolder string, upload func(body *os.File, size int64, payloadHash string) error) (ret *uploadOut, err error) {
+	var file *os.File
+	if file, err = ioutil.TempFile(tempFolder, "upload_"); err == nil {
+		ret = &uploadOut{file: file, hash: sha256.New(), upload: upload}
+	}
+	return
+}
+
+func (o *uploadOut) Write(p []byte) (n int, err error) {
+	if n, err = o.file.Write(p); n > 0 {
+		o.hash.Write(p[:n])
+		o.size += int64(n)
+	}
+	return
+}
+
+func (o *uploadOut) Close() (err error) {
+	defer os.Remove(o.file.Name())
+	defer o.file.Close()
+
+	if _, err = o.file.Seek(0, io.SeekStart); err == nil {
+		err = o.upload(o.file, o.size, hex.EncodeToString(o.hash.Sum(nil)))
+	}
+	return
+}
+
+func (o *uploadOut) Abort() (err error) {
+	o.file.Close()
+	return os.Remove(o.file.Name())
+}
+
+func uploadHttp(target *ExportTarget, access as.Access, fileName string, body io.Reader, size int64) (err error) {
+	var req *http.Request
+	uploadUrl := strings.Replace(target.Url, "@@FILE@@", url.PathEscape(fileName), -1)
+	if req, err = http.NewRequest(target.method(), uploadUrl, body); err != nil {
+		return
+	}
+	req.ContentLength = size
+	req.Header.Set("Content-Type", target.contentType())
+	if len(access.User) > 0 {
+		req.SetBasicAuth(access.User, access.Password)
+	}
+	return executeUpload(target.client(), req)
+}
+
+func uploadS3(target *ExportTarget, access as.Access, fileName string, body io.Reader, size int64,
+	payloadHash string) (err error) {
+
+	key := strings.TrimPrefix(path.Join(target.Prefix, fileName), "/")
+	objectUrl := fmt.Sprintf("%v/%v/%v", strings.TrimSuffix(target.Url, "/"), target.Bucket, key)
+
+	var req *http.Request
+	if req, err = http.NewRequest(http.MethodPut, objectUrl, body); err != nil {
+		return
+	}
+	req.ContentLength = size
+	req.Header.Set("Content-Type", target.contentType())
+	signS3(req, access, target.region(), payloadHash, time.Now().UTC())
+	return executeUpload(target.client(), req)
+}
+
+func executeUpload(client *http.Client, req *http.Request) (err error) {
+	var resp *http.Response
+	if resp, err = client.Do(req); err != nil {
+		return
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		data, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+		err = errors.New(fmt.Sprintf("Upload to '%v' failed with status '%v': %s", req.URL, resp.Status, data))
+	}
+	return
+}
+
+//signS3 signs the request with AWS signature version 4, as supported by S3-compatible storages
+func signS3(req *http.Request, access as.Access, region string, payloadHash string, now time.Time) {
+	amzDate := now.Format("20060102T150405Z")
+	day := now.Format("20060102")
+
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	signedHeaders := "host;x-amz-content-sha256;x-amz-date"
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		s3EscapePath(req.URL.Path),
+		req.URL.RawQuery,
+		fmt.Sprintf("host:%v\nx-amz-content-sha256:%v\nx-amz-date:%v\n", req.URL.Host, payloadHash, amzDate),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := fmt.Sprintf("%v/%v/s3/aws4_request", day, region)
+	canonicalHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := strings.Join([]string{"AWS4-HMAC-SHA256", amzDate, scope,
+		hex.EncodeToString(canonicalHash[:])}, "\n")
+
+	key := hmacSha256([]byte("AWS4"+access.Password), day)
+	key = hmacSha256(key, region)
+	key = hmacSha256(key, "s3")
+	key = hmacSha256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSha256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%v/%v, SignedHeaders=%v, Signature=%v",
+		access.User, scope, signedHeaders, signature))
+}
+
+func hmacSha256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+func s3EscapePath(path string) string {
+	var buffer bytes.Buffer
+	for _, b := range []byte(path) {
+		if (b >= 'A' && b <= 'Z') || (b >= 'a' && b <= 'z') || (b >= '0' && b <= '9') ||
+			b == '-' || b == '_' || b == '.' || b == '~' || b == '/' {
+			buffer.WriteByte(b)
+		} else {
+			buffer.WriteString(fmt.Sprintf("%%%02X", b))
+		}
+	}
+	return buffer.String()
+}
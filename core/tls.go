@@ -0,0 +1,83 @@
+package core
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"github.com/eugeis/gee/as"
+	"io/ioutil"
+)
+
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// Tls configures the verification of the server and the client certificate, the verification is on by default.
+type Tls struct {
+	//PEM encoded CA bundle, the system CAs are used if not set
+	CaFile string
+
+	CertFile string
+	KeyFile  string
+	//alternative to CertFile/KeyFile: the access user is the PEM encoded certificate and the password the key
+	CertAccessKey string
+
+	ServerName string
+	//1.0, 1.1, 1.2 (default) or 1.3
+	MinVersion string
+
+	InsecureSkipVerify bool
+}
+
+func (o *Tls) Config(accessFinder as.AccessFinder) (ret *tls.Config, err error) {
+	ret = &tls.Config{ServerName: o.ServerName, InsecureSkipVerify: o.InsecureSkipVerify, MinVersion: tls.VersionTLS12}
+
+	if len(o.MinVersion) > 0 {
+		var ok bool
+		if ret.MinVersion, ok = tlsVersions[o.MinVersion]; !ok {
+			err = errors.New(fmt.Sprintf("The TLS version '%v' is not supported", o.MinVersion))
+			return
+		}
+	}
+
+	if len(o.CaFile) > 0 {
+		var data []byte
+		if data, err = ioutil.ReadFile(o.CaFile); err != nil {
+			return
+		}
+		ret.RootCAs = x509.NewCertPool()
+		if !ret.RootCAs.AppendCertsFromPEM(data) {
+			err = errors.New(fmt.Sprintf("No certificates found in the CA file '%v'", o.CaFile))
+			return
+		}
+	}
+
+	var cert tls.Certificate
+	if len(o.CertFile) > 0 {
+		if cert, err = tls.LoadX509KeyPair(o.CertFile, o.KeyFile); err != nil {
+			return
+		}
+		ret.Certificates = []tls.Certificate{cert}
+	} else if len(o.CertAccessKey) > 0 {
+		var access as.Access
+		if access, err = accessFinder.FindAccess(o.CertAccessKey); err != nil {
+			return
+		}
+		if cert, err = tls.X509KeyPair([]byte(access.User), []byte(access.Password)); err != nil {
+			return
+		}
+		ret.Certificates = []tls.Certificate{cert}
+	}
+	return
+}
+
+func (o *Tls) accessKeys() (ret []string) {
+	if o != nil && len(o.CertAccessKey) > 0 {
+		ret = []string{o.CertAccessKey}
+	}
+	return
+}
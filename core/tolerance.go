@@ -0,0 +1,153 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//field name of the tolerance for all fields without an own tolerance
+const ToleranceAllFields = "*"
+
+// tolerance is the compiled tolerance spec of a compare field, e.g. '0.1%', '5', '30s', 'trim+lower', 'round2'.
+// Values are equal, if they are equal after the normalisation or their difference is within one of the tolerances.
+type tolerance struct {
+	absolute float64
+	percent  float64
+	//time skew in seconds
+	skew  float64
+	trim  bool
+	lower bool
+	round int
+	//round is set
+	rounded bool
+}
+
+//compileTolerances parses the tolerance specs per field
+func compileTolerances(specs map[string]string) (ret map[string]*tolerance, err error) {
+	if len(specs) == 0 {
+		return
+	}
+	ret = make(map[string]*tolerance, len(specs))
+	for field, spec := range specs {
+		if ret[field], err = compileTolerance(spec); err != nil {
+			err = errors.New(fmt.Sprintf("Invalid tolerance '%v' of the field '%v': %v", spec, field, err))
+			ret = nil
+			return
+		}
+	}
+	return
+}
+
+//compileTolerance parses the parts of the spec, separated by '+' or space
+func compileTolerance(spec string) (ret *tolerance, err error) {
+	ret = &tolerance{}
+	parts := strings.FieldsFunc(spec, func(c rune) bool { return c == '+' || c == ' ' })
+	for _, part := range parts {
+		lowerPart := strings.ToLower(part)
+		switch {
+		case lowerPart == "trim":
+			ret.trim = true
+		case lowerPart == "lower" || lowerPart == "casefold":
+			ret.lower = true
+		case strings.HasPrefix(lowerPart, "round"):
+			ret.rounded = true
+			if decimals := strings.TrimPrefix(lowerPart, "round"); len(decimals) > 0 {
+				ret.round, err = strconv.Atoi(decimals)
+			}
+		case strings.HasSuffix(part, "%"):
+			ret.percent, err = strconv.ParseFloat(strings.TrimSuffix(part, "%"), 64)
+		default:
+			if ret.absolute, err = strconv.ParseFloat(part, 64); err != nil {
+				var skew interface{}
+				if skew, err = evalParseDuration(part); err == nil {
+					ret.skew = skew.(float64)
+				} else {
+					err = errors.New(fmt.Sprintf("'%v' is neither a number, percent, duration nor normalisation", part))
+				}
+			}
+		}
+		if err != nil {
+			ret = nil
+			return
+		}
+	}
+	return
+}
+
+func toleranceOf(tolerances map[string]*tolerance, field string) (ret *tolerance) {
+	if ret = tolerances[field]; ret == nil {
+		ret = tolerances[ToleranceAllFields]
+	}
+	return
+}
+
+//equal compares the normalised values within the tolerances, without tolerance like valuesEqual
+func (o *tolerance) equal(a interface{}, b interface{}) bool {
+	if o == nil {
+		return valuesEqual(a, b)
+	}
+	a, b = o.normalize(a), o.normalize(b)
+	if a == nil || b == nil || valuesEqual(a, b) {
+		return valuesEqual(a, b)
+	}
+
+	if o.skew > 0 {
+		if aSeconds, err := timeSeconds(a); err == nil {
+			if bSeconds, err := timeSeconds(b); err == nil {
+				return math.Abs(aSeconds-bSeconds) <= o.skew
+			}
+		}
+	}
+
+	if aNumber, err := toFloat(a); err == nil {
+		if bNumber, err := toFloat(b); err == nil {
+			diff := math.Abs(aNumber - bNumber)
+			return diff <= o.absolute ||
+				diff <= o.percent/100*math.Max(math.Abs(aNumber), math.Abs(bNumber))
+		}
+	}
+	return false
+}
+
+func (o *tolerance) normalize(value interface{}) interface{} {
+	if b, ok := value.([]byte); ok {
+		value = string(b)
+	}
+	if text, ok := value.(string); ok {
+		if o.trim {
+			text = strings.TrimSpace(text)
+		}
+		if o.lower {
+			text = strings.ToLower(text)
+		}
+		value = text
+	}
+	if o.rounded {
+		if number, err := toFloat(value); err == nil {
+			factor := math.Pow(10, float64(o.round))
+			value = math.Round(number*factor) / factor
+		}
+	}
+	return value
+}
+
+//timeSeconds converts times, RFC3339, date time and date texts and unix seconds
+func timeSeconds(value interface{}) (ret float64, err error) {
+	if ret, err = toUnixSeconds(value); err == nil {
+		return
+	}
+	if text, ok := value.(string); ok {
+		for _, layout := range []string{timeLayouts[LayoutDateTime], timeLayouts[LayoutDate]} {
+			var parsed time.Time
+			if parsed, err = time.Parse(layout, text); err == nil {
+				ret = unixSeconds(parsed)
+				return
+			}
+		}
+	}
+	return
+}
@@ -0,0 +1,65 @@
+package core
+
+import (
+	"testing"
+)
+
+func TestToleranceEqual(t *testing.T) {
+	for _, item := range []struct {
+		spec  string
+		a     interface{}
+		b     interface{}
+		equal bool
+	}{
+		{"", 10, "10", true},
+		{"", 10, 11, false},
+		{"0.1%", int64(100000), int64(100100), true},
+		{"0.1%", int64(100000), int64(100101), false},
+		{"5", 100, []byte("105"), true},
+		{"5", 100, 106, false},
+		{"30s", "2020-03-15 10:00:00", "2020-03-15T10:00:25Z", true},
+		{"30s", "2020-03-15 10:00:00", "2020-03-15 10:01:00", false},
+		{"trim+lower", " InnoDB", "innodb ", true},
+		{"trim", " InnoDB", "innodb", false},
+		{"round2", 1.004, 1.001, true},
+		{"round", 1.4, 1.6, false},
+		{"1+round", 1.4, 1.6, true},
+		{"0.1%", nil, 0, false},
+		{"0.1%", nil, nil, true},
+	} {
+		tolerance, err := compileTolerance(item.spec)
+		AssertEqual(t, err, nil, ErrorMessageBuilder)
+		if item.spec == "" {
+			tolerance = nil
+		}
+		if tolerance.equal(item.a, item.b) != item.equal {
+			t.Fatalf("'%v': %v == %v should be %v", item.spec, item.a, item.b, item.equal)
+		}
+	}
+
+	for _, spec := range []string{"abc", "round-x", "%"} {
+		_, err := compileTolerance(spec)
+		AssertEqual(t, err != nil, true, nil)
+	}
+}
+
+func TestMultiCheckTolerances(t *testing.T) {
+	service1 := &staticQuery{data: rows(map[string]interface{}{"table": "users", "count": int64(100000)},
+		map[string]interface{}{"table": "orders", "count": int64(2000)})}
+	service2 := &staticQuery{data: rows(map[string]interface{}{"table": "users", "count": "100090"},
+		map[string]interface{}{"table": "orders", "count": int64(2001)})}
+
+	tolerances, err := compileTolerances(map[string]string{"*": "0.1%"})
+	AssertEqual(t, err, nil, ErrorMessageBuilder)
+	check := &MultiCheck{info: "test", queries: []Query{service1, service2}, joinKeys: []string{"table"},
+		equalFields: []string{"count"}, tolerances: tolerances}
+	AssertEqual(t, check.Validate(), nil, ErrorMessageBuilder)
+
+	check.tolerances, _ = compileTolerances(map[string]string{"count": "0.06%"})
+	report, _ := check.Diff()
+	AssertEqual(t, len(report.Rows), 1, nil)
+	AssertEqual(t, report.Rows[0].Key["table"], "users", nil)
+
+	_, err = compileTolerances(map[string]string{"count": "often"})
+	AssertEqual(t, err != nil, true, nil)
+}
@@ -0,0 +1,222 @@
+package digest
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Authenticator adds credentials to the requests and handles the '401 Unauthorized' responses.
+type Authenticator interface {
+	Authorize(dr *Request, req *http.Request) error
+	//Challenge returns true, if the request shall be repeated with new credentials
+	Challenge(dr *Request, resp *http.Response) (retry bool, err error)
+}
+
+// NoAuth sends the requests without credentials.
+type NoAuth struct {
+}
+
+func (o NoAuth) Authorize(dr *Request, req *http.Request) error {
+	return nil
+}
+
+func (o NoAuth) Challenge(dr *Request, resp *http.Response) (bool, error) {
+	return false, nil
+}
+
+// DigestAuth authenticates with the Username and Password of the request, after the digest challenge of the server.
+// The nonces are cached per host and user, so that concurrent requests share them with distinct nonce counts.
+type DigestAuth struct {
+}
+
+func (o DigestAuth) Authorize(dr *Request, req *http.Request) error {
+	if nonce := nonces.get(nonceKey(req.URL, dr.Username)); nonce != nil {
+		auth := newAuthorization(nonce.wa)
+		auth.refreshAuthorization(dr, req.URL.RequestURI(), nonce.nextNc())
+		req.Header.Set("Authorization", auth.toString())
+	}
+	return nil
+}
+
+// Challenge selects the strongest digest challenge and repeats the request with its nonce. If the request was
+// authorized with the same nonce and it is not marked as stale, the credentials were rejected and the request is not repeated.
+func (o DigestAuth) Challenge(dr *Request, resp *http.Response) (retry bool, err error) {
+	headers := resp.Header["Www-Authenticate"]
+	if len(headers) == 0 {
+		err = errors.New("Failed to get WWW-Authenticate header, please check your server configuration.")
+		return
+	}
+
+	var wa *wwwAuthenticate
+	if wa, err = selectWwwAuthenticate(headers); err != nil {
+		return
+	}
+
+	key := nonceKey(resp.Request.URL, dr.Username)
+	if !wa.Stale && sentNonce(resp.Request) == wa.Nonce {
+		nonces.remove(key)
+		return
+	}
+	nonces.put(key, wa)
+	retry = true
+	return
+}
+
+//sentNonce returns the nonce of the digest authorization of the request
+func sentNonce(req *http.Request) (ret string) {
+	if authHeader := req.Header.Get("Authorization"); authHeader != "" {
+		for _, item := range parseChallenges(authHeader) {
+			if strings.EqualFold(item.Scheme, "Digest") {
+				ret = item.Params["nonce"]
+			}
+		}
+	}
+	return
+}
+
+type BasicAuth struct {
+	Username string
+	Password string
+}
+
+func (o *BasicAuth) Authorize(dr *Request, req *http.Request) error {
+	req.SetBasicAuth(o.Username, o.Password)
+	return nil
+}
+
+func (o *BasicAuth) Challenge(dr *Request, resp *http.Response) (bool, error) {
+	return false, nil
+}
+
+type BearerAuth struct {
+	Token string
+}
+
+func (o *BearerAuth) Authorize(dr *Request, req *http.Request) error {
+	req.Header.Set("Authorization", "Bearer "+o.Token)
+	return nil
+}
+
+func (o *BearerAuth) Challenge(dr *Request, resp *http.Response) (bool, error) {
+	return false, nil
+}
+
+// OAuth2ClientCredentials fetches a token with the client credentials grant and caches it until it expires.
+type OAuth2ClientCredentials struct {
+	TokenUrl     string
+	ClientId     string
+	ClientSecret string
+	Scopes       []string
+	Client       *http.Client
+
+	token  string
+	expiry time.Time
+	lock   sync.Mutex
+}
+
+type oauth2Token struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	ExpiresIn   int64  `json:"expires_in"`
+}
+
+func (o *OAuth2ClientCredentials) Authorize(dr *Request, req *http.Request) (err error) {
+	var token string
+	if token, err = o.Token(); err == nil {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	return
+}
+
+// Challenge drops the cached token, if it was rejected, because it may be revoked, and repeats the request with
+// the cached or a new one. A token refreshed meanwhile by another request is kept.
+func (o *OAuth2ClientCredentials) Challenge(dr *Request, resp *http.Response) (retry bool, err error) {
+	var rejected string
+	if resp.Request != nil {
+		rejected = strings.TrimPrefix(resp.Request.Header.Get("Authorization"), "Bearer ")
+	}
+	o.lock.Lock()
+	retry = rejected != ""
+	if o.token == rejected {
+		o.token = ""
+	}
+	o.lock.Unlock()
+	return
+}
+
+func (o *OAuth2ClientCredentials) Token() (ret string, err error) {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+
+	if o.token == "" || time.Now().After(o.expiry) {
+		o.token, o.expiry, err = o.fetchToken()
+	}
+	ret = o.token
+	return
+}
+
+func (o *OAuth2ClientCredentials) fetchToken() (token string, expiry time.Time, err error) {
+	form := url.Values{"grant_type": {"client_credentials"}}
+	if len(o.Scopes) > 0 {
+		form.Set("scope", strings.Join(o.Scopes, " "))
+	}
+
+	var req *http.Request
+	if req, err = http.NewRequest(http.MethodPost, o.TokenUrl, strings.NewReader(form.Encode())); err != nil {
+		return
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	req.SetBasicAuth(url.QueryEscape(o.ClientId), url.QueryEscape(o.ClientSecret))
+
+	client := o.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	var resp *http.Response
+	if resp, err = client.Do(req); err != nil {
+		return
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		data, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+		err = errors.New(fmt.Sprintf("Token request to %v failed with status '%v': %s", o.TokenUrl, resp.Status, data))
+		return
+	}
+
+	var data oauth2Token
+	if err = json.NewDecoder(resp.Body).Decode(&data); err != nil {
+		return
+	}
+	if data.AccessToken == "" {
+		err = errors.New(fmt.Sprintf("Token response of %v contains no access_token", o.TokenUrl))
+		return
+	}
+
+	token = data.AccessToken
+	if data.ExpiresIn > 0 {
+		expiry = time.Now().Add(tokenLifetime(time.Duration(data.ExpiresIn) * time.Second))
+	} else {
+		expiry = time.Now().Add(time.Hour)
+	}
+	return
+}
+
+//tokenLifetime refreshes 30 seconds before the token expires, at most after 90% of short lifetimes
+func tokenLifetime(expiresIn time.Duration) time.Duration {
+	skew := 30 * time.Second
+	if maxSkew := expiresIn / 10; skew > maxSkew {
+		skew = maxSkew
+	}
+	return expiresIn - skew
+}
@@ -3,15 +3,14 @@ package digest
 import (
 	"bytes"
 	"crypto/md5"
+	"crypto/rand"
 	"crypto/sha256"
+	"crypto/sha512"
 	"encoding/hex"
 	"fmt"
 	"hash"
 	"io"
-	"net/url"
-	"regexp"
 	"strings"
-	"time"
 )
 
 type authorization struct {
@@ -29,54 +28,66 @@ type authorization struct {
 	Username_ string
 }
 
-func newAuthorization(dr *Request) (*authorization, error) {
+func newAuthorization(wa *wwwAuthenticate) *authorization {
 
 	ah := authorization{
-		Algorithm: dr.Wa.Algorithm,
+		Algorithm: wa.Algorithm,
 		Cnonce:    "",
 		Nc:        0,
-		Nonce:     dr.Wa.Nonce,
-		Opaque:    dr.Wa.Opaque,
-		Qop:       "",
-		Realm:     dr.Wa.Realm,
+		Nonce:     wa.Nonce,
+		Opaque:    wa.Opaque,
+		Qop:       selectQop(wa.Qop),
+		Realm:     wa.Realm,
 		Response:  "",
 		Uri:       "",
-		Userhash:  dr.Wa.Userhash,
+		Userhash:  wa.Userhash,
 		Username:  "",
-		Username_: "", // TODO
+		Username_: "",
 	}
 
-	return ah.refreshAuthorization(dr, true)
+	return &ah
 }
 
-func (ah *authorization) refreshAuthorization(dr *Request, updateUri bool) (*authorization, error) {
+//selectQop prefers 'auth' over 'auth-int', empty for servers without qop support (RFC 2069)
+func selectQop(offered string) (ret string) {
+	for _, item := range strings.Split(offered, ",") {
+		item = strings.ToLower(strings.TrimSpace(item))
+		if item == "auth" {
+			return item
+		} else if item == "auth-int" {
+			ret = item
+		}
+	}
+	return
+}
+
+func (ah *authorization) refreshAuthorization(dr *Request, uri string, nc int) {
 
 	ah.Username = dr.Username
+	ah.Username_ = ""
 
 	if ah.Userhash {
-		ah.Username = ah.hash(fmt.Sprintf("%v:%v", ah.Username, ah.Realm))
+		ah.Username = ah.hash(fmt.Sprintf("%v:%v", dr.Username, ah.Realm))
+	} else if !isAscii(dr.Username) {
+		ah.Username = ""
+		ah.Username_ = encodeExtValue(dr.Username)
 	}
 
-	ah.Nc++
-
-	ah.Cnonce = ah.hash(fmt.Sprintf("%d:%v:my_value", time.Now().UnixNano(), dr.Username))
-
-	if updateUri {
-		url, err := url.Parse(dr.Uri)
-		if err != nil {
-			return nil, err
-		}
-		ah.Uri = url.RequestURI()
+	if ah.Qop != "" {
+		ah.Nc = nc
+		ah.Cnonce = newCnonce()
 	}
 
+	ah.Uri = uri
 	ah.Response = ah.computeResponse(dr)
-
-	return ah, nil
 }
 
 func (ah *authorization) computeResponse(dr *Request) (s string) {
 
 	kdSecret := ah.hash(ah.computeA1(dr))
+	if ah.Qop == "" {
+		return ah.hash(fmt.Sprintf("%v:%v:%v", kdSecret, ah.Nonce, ah.hash(ah.computeA2(dr))))
+	}
 	kdData := fmt.Sprintf("%v:%08x:%v:%v:%v", ah.Nonce, ah.Nc, ah.Cnonce, ah.Qop, ah.hash(ah.computeA2(dr)))
 
 	return ah.hash(fmt.Sprintf("%v:%v", kdSecret, kdData))
@@ -84,41 +95,35 @@ func (ah *authorization) computeResponse(dr *Request) (s string) {
 
 func (ah *authorization) computeA1(dr *Request) string {
 
-	if ah.Algorithm == "" || ah.Algorithm == "MD5" || ah.Algorithm == "SHA-256" {
-		return fmt.Sprintf("%v:%v:%s", ah.Username, ah.Realm, dr.Password)
-	}
+	a1 := fmt.Sprintf("%v:%v:%s", dr.Username, ah.Realm, dr.Password)
 
-	if ah.Algorithm == "MD5-sess" || ah.Algorithm == "SHA-256-sess" {
-		upHash := ah.hash(fmt.Sprintf("%v:%v:%s", ah.Username, ah.Realm, dr.Password))
-		return fmt.Sprintf("%v:%v:%v", upHash, ah.Nonce, ah.Cnonce)
+	if strings.HasSuffix(strings.ToUpper(ah.Algorithm), "-SESS") {
+		return fmt.Sprintf("%v:%v:%v", ah.hash(a1), ah.Nonce, ah.Cnonce)
 	}
 
-	return ""
+	return a1
 }
 
 func (ah *authorization) computeA2(dr *Request) string {
 
-	if matched, _ := regexp.MatchString("auth-int", dr.Wa.Qop); matched {
-		ah.Qop = "auth-int"
+	if ah.Qop == "auth-int" {
 		return fmt.Sprintf("%v:%v:%v", dr.Method, ah.Uri, ah.hash(dr.Body))
 	}
 
-	if dr.Wa.Qop == "auth" || dr.Wa.Qop == "" {
-		ah.Qop = "auth"
-		return fmt.Sprintf("%v:%v", dr.Method, ah.Uri)
-	}
-
-	return ""
+	return fmt.Sprintf("%v:%v", dr.Method, ah.Uri)
 }
 
 func (ah *authorization) hash(a string) (s string) {
 
 	var h hash.Hash
 
-	if ah.Algorithm == "" || ah.Algorithm == "MD5" || ah.Algorithm == "MD5-sess" {
-		h = md5.New()
-	} else if ah.Algorithm == "SHA-256" || ah.Algorithm == "SHA-256-sess" {
+	switch baseAlgorithm(ah.Algorithm) {
+	case "SHA-256":
 		h = sha256.New()
+	case "SHA-512-256":
+		h = sha512.New512_256()
+	default:
+		h = md5.New()
 	}
 
 	io.WriteString(h, a)
@@ -127,6 +132,40 @@ func (ah *authorization) hash(a string) (s string) {
 	return
 }
 
+func newCnonce() string {
+	b := make([]byte, 16)
+	io.ReadFull(rand.Reader, b)
+	return hex.EncodeToString(b)
+}
+
+func isAscii(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] > 127 {
+			return false
+		}
+	}
+	return true
+}
+
+//encodeExtValue encodes the value as RFC 5987 ext-value, e.g. UTF-8''J%C3%A4s%C3%B8n
+func encodeExtValue(s string) string {
+	var buffer bytes.Buffer
+	buffer.WriteString("UTF-8''")
+	for _, b := range []byte(s) {
+		if (b >= 'A' && b <= 'Z') || (b >= 'a' && b <= 'z') || (b >= '0' && b <= '9') ||
+			strings.IndexByte("!#$&+-.^_`|~", b) >= 0 {
+			buffer.WriteByte(b)
+		} else {
+			buffer.WriteString(fmt.Sprintf("%%%02X", b))
+		}
+	}
+	return buffer.String()
+}
+
+func quote(s string) string {
+	return strings.Replace(strings.Replace(s, `\`, `\\`, -1), `"`, `\"`, -1)
+}
+
 func (ah *authorization) toString() string {
 	var buffer bytes.Buffer
 
@@ -145,11 +184,11 @@ func (ah *authorization) toString() string {
 	}
 
 	if ah.Opaque != "" {
-		buffer.WriteString(fmt.Sprintf("opaque=\"%v\", ", ah.Opaque))
+		buffer.WriteString(fmt.Sprintf("opaque=\"%v\", ", quote(ah.Opaque)))
 	}
 
 	if ah.Nonce != "" {
-		buffer.WriteString(fmt.Sprintf("nonce=\"%v\", ", ah.Nonce))
+		buffer.WriteString(fmt.Sprintf("nonce=\"%v\", ", quote(ah.Nonce)))
 	}
 
 	if ah.Qop != "" {
@@ -157,7 +196,7 @@ func (ah *authorization) toString() string {
 	}
 
 	if ah.Realm != "" {
-		buffer.WriteString(fmt.Sprintf("realm=\"%v\", ", ah.Realm))
+		buffer.WriteString(fmt.Sprintf("realm=\"%v\", ", quote(ah.Realm)))
 	}
 
 	if ah.Response != "" {
@@ -165,7 +204,7 @@ func (ah *authorization) toString() string {
 	}
 
 	if ah.Uri != "" {
-		buffer.WriteString(fmt.Sprintf("uri=\"%v\", ", ah.Uri))
+		buffer.WriteString(fmt.Sprintf("uri=\"%v\", ", quote(ah.Uri)))
 	}
 
 	if ah.Userhash {
@@ -173,7 +212,11 @@ func (ah *authorization) toString() string {
 	}
 
 	if ah.Username != "" {
-		buffer.WriteString(fmt.Sprintf("username=\"%v\", ", ah.Username))
+		buffer.WriteString(fmt.Sprintf("username=\"%v\", ", quote(ah.Username)))
+	}
+
+	if ah.Username_ != "" {
+		buffer.WriteString(fmt.Sprintf("username*=%v, ", ah.Username_))
 	}
 
 	s := buffer.String()
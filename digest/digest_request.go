@@ -2,10 +2,11 @@ package digest
 
 import (
 	"bytes"
+	"context"
 	"crypto/tls"
-	"fmt"
 	"net/http"
 	"net/http/cookiejar"
+	"net/url"
 	"time"
 )
 
@@ -15,16 +16,30 @@ type Request struct {
 	Password    string
 	Uri         string
 	Username    string
-	Auth        *authorization
-	Wa          *wwwAuthenticate
 	ContentType string
+	Header      http.Header
+
+	//Authenticator of the request, digest authentication if not set
+	Authenticator Authenticator
 }
 
 func NewClient(skipTLSVerify bool, timeout time.Duration) (ret *http.Client) {
-	cookieJar, _ := cookiejar.New(nil)
 	if skipTLSVerify {
+		return NewClientTls(&tls.Config{InsecureSkipVerify: true}, nil, timeout)
+	}
+	return NewClientTls(nil, nil, timeout)
+}
+
+//NewClientTls builds a client with the TLS config and proxy, the proxy from environment is used if not set
+func NewClientTls(tlsConfig *tls.Config, proxy *url.URL, timeout time.Duration) (ret *http.Client) {
+	cookieJar, _ := cookiejar.New(nil)
+	if tlsConfig != nil || proxy != nil {
 		tr := &http.Transport{
-			TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+			Proxy:           http.ProxyFromEnvironment,
+			TLSClientConfig: tlsConfig,
+		}
+		if proxy != nil {
+			tr.Proxy = http.ProxyURL(proxy)
 		}
 
 		ret = &http.Client{
@@ -44,6 +59,12 @@ func NewRequest(username string, password string, method string, uri string, bod
 	return dr
 }
 
+func NewRequestWithAuth(authenticator Authenticator, method string, uri string, body string) Request {
+	dr := NewRequest("", "", method, uri, body)
+	dr.Authenticator = authenticator
+	return dr
+}
+
 func (dr *Request) Close() {
 }
 
@@ -59,77 +80,33 @@ func (dr *Request) UpdateRequest(username string,
 }
 
 func (dr *Request) Execute(client *http.Client) (resp *http.Response, err error) {
-	if dr.Auth == nil {
-		var req *http.Request
-		req, err = http.NewRequest(dr.Method, dr.Uri, bytes.NewReader([]byte(dr.Body)))
-		if err == nil {
-			if dr.ContentType != "" {
-				req.Header.Set("Content-Type", dr.ContentType)
-			}
-
-			resp, err = client.Do(req)
-			if err == nil && resp.StatusCode == 401 {
-				resp, err = dr.executeNewDigest(resp, client)
-			}
-		}
-	} else {
-		resp, err = dr.executeExistingDigest(client)
-		if err == nil && resp.StatusCode == 401 {
-			//reset and start new request with auth
+	return dr.ExecuteContext(context.Background(), client)
+}
+
+//ExecuteContext does not modify the request, so it can be executed concurrently
+func (dr *Request) ExecuteContext(ctx context.Context, client *http.Client) (resp *http.Response, err error) {
+	auth := dr.authenticator()
+	if resp, err = dr.executeRequest(ctx, auth, client); err == nil && resp.StatusCode == http.StatusUnauthorized {
+		var retry bool
+		if retry, err = auth.Challenge(dr, resp); err != nil {
+			resp.Body.Close()
+			resp = nil
+		} else if retry {
 			resp.Body.Close()
-			dr.Auth = nil
-			resp, err = dr.Execute(client)
+			resp, err = dr.executeRequest(ctx, auth, client)
 		}
 	}
 	return
 }
 
-func (dr *Request) executeNewDigest(resp *http.Response, client *http.Client) (*http.Response, error) {
-	var (
-		auth *authorization
-		err  error
-		wa   *wwwAuthenticate
-	)
-
-	waString := resp.Header.Get("WWW-Authenticate")
-
-	resp.Body.Close()
-
-	if waString == "" {
-		return nil, fmt.Errorf("Failed to get WWW-Authenticate header, please check your server configuration.")
-	}
-	wa = newWwwAuthenticate(waString)
-	dr.Wa = wa
-
-	if auth, err = newAuthorization(dr); err != nil {
-		return nil, err
-	}
-	authString := auth.toString()
-
-	if resp, err := dr.executeRequest(authString, client); err != nil {
-		return nil, err
-	} else {
-		dr.Auth = auth
-		return resp, nil
-	}
-}
-
-func (dr *Request) executeExistingDigest(client *http.Client) (*http.Response, error) {
-	var (
-		auth *authorization
-		err  error
-	)
-
-	if auth, err = dr.Auth.refreshAuthorization(dr, true); err != nil {
-		return nil, err
+func (dr *Request) authenticator() Authenticator {
+	if dr.Authenticator != nil {
+		return dr.Authenticator
 	}
-	dr.Auth = auth
-
-	authString := dr.Auth.toString()
-	return dr.executeRequest(authString, client)
+	return DigestAuth{}
 }
 
-func (dr *Request) executeRequest(authString string, client *http.Client) (*http.Response, error) {
+func (dr *Request) executeRequest(ctx context.Context, auth Authenticator, client *http.Client) (*http.Response, error) {
 	var (
 		err error
 		req *http.Request
@@ -138,12 +115,17 @@ func (dr *Request) executeRequest(authString string, client *http.Client) (*http
 	if req, err = http.NewRequest(dr.Method, dr.Uri, bytes.NewReader([]byte(dr.Body))); err != nil {
 		return nil, err
 	}
+	req = req.WithContext(ctx)
 
-	// fmt.Printf("AUTHSTRING: %v\n\n", authString)
-	req.Header.Add("Authorization", authString)
-
+	for key, values := range dr.Header {
+		req.Header[key] = values
+	}
 	if dr.ContentType != "" {
 		req.Header.Set("Content-Type", dr.ContentType)
 	}
+
+	if err = auth.Authorize(dr, req); err != nil {
+		return nil, err
+	}
 	return client.Do(req)
 }
@@ -0,0 +1,424 @@
+package digest
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+//digestServer verifies the digest authorization independently of the client implementation
+type digestServer struct {
+	realm      string
+	username   string
+	password   string
+	challenges []string
+	algorithm  string
+	qop        string
+	userhash   bool
+	//nonce gets stale after the number of requests, 0 for never
+	staleAfter int
+
+	lock     sync.Mutex
+	nonce    string
+	nonces   int
+	used     int
+	requests int
+	ncs      map[string]bool
+	rejected []string
+}
+
+func (o *digestServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+
+	o.requests++
+	if o.nonce == "" {
+		o.newNonce()
+	}
+
+	authHeader := r.Header.Get("Authorization")
+	if authHeader == "" {
+		o.challenge(w, false)
+		return
+	}
+
+	params := parseChallenges(authHeader)[0].Params
+	if params["nonce"] != o.nonce {
+		o.challenge(w, false)
+		return
+	}
+	if o.staleAfter > 0 && o.used >= o.staleAfter {
+		o.newNonce()
+		o.challenge(w, true)
+		return
+	}
+
+	//rejected credentials are answered by a fresh challenge
+	if err := o.verify(r, params); err != nil {
+		o.rejected = append(o.rejected, err.Error())
+		o.newNonce()
+		o.challenge(w, false)
+		return
+	}
+	o.used++
+	io.WriteString(w, "OK")
+}
+
+func (o *digestServer) newNonce() {
+	o.nonces++
+	o.nonce = fmt.Sprintf("nonce-%d-%d", o.nonces, time.Now().UnixNano())
+	o.used = 0
+}
+
+func (o *digestServer) challenge(w http.ResponseWriter, stale bool) {
+	challenges := o.challenges
+	if len(challenges) == 0 {
+		challenge := fmt.Sprintf(`Digest realm="%v", nonce="@@NONCE@@", opaque="abc"`, o.realm)
+		if o.algorithm != "" {
+			challenge += ", algorithm=" + o.algorithm
+		}
+		if o.qop != "" {
+			challenge += fmt.Sprintf(`, qop="%v"`, o.qop)
+		}
+		if o.userhash {
+			challenge += ", userhash=true"
+		}
+		challenges = []string{challenge}
+	}
+	for _, challenge := range challenges {
+		challenge = strings.Replace(challenge, "@@NONCE@@", o.nonce, -1)
+		if stale {
+			challenge += ", stale=true"
+		}
+		w.Header().Add("WWW-Authenticate", challenge)
+	}
+	w.WriteHeader(http.StatusUnauthorized)
+}
+
+func (o *digestServer) verify(r *http.Request, params map[string]string) (err error) {
+	algorithm := params["algorithm"]
+	h := func(s string) string {
+		var hash hash.Hash
+		switch strings.TrimSuffix(strings.ToUpper(algorithm), "-SESS") {
+		case "SHA-256":
+			hash = sha256.New()
+		case "SHA-512-256":
+			hash = sha512.New512_256()
+		default:
+			hash = md5.New()
+		}
+		io.WriteString(hash, s)
+		return hex.EncodeToString(hash.Sum(nil))
+	}
+
+	username := params["username"]
+	if params["userhash"] == "true" {
+		if username != h(o.username+":"+o.realm) {
+			return fmt.Errorf("wrong userhash %v", username)
+		}
+		username = o.username
+	} else if extValue, ok := params["username*"]; ok {
+		if username, err = url.PathUnescape(strings.TrimPrefix(extValue, "UTF-8''")); err != nil {
+			return
+		}
+	}
+	if username != o.username {
+		return fmt.Errorf("wrong username %v", username)
+	}
+
+	if params["uri"] != r.URL.RequestURI() {
+		return fmt.Errorf("wrong uri %v", params["uri"])
+	}
+
+	ha1 := h(fmt.Sprintf("%v:%v:%v", username, o.realm, o.password))
+	if strings.HasSuffix(strings.ToUpper(algorithm), "-SESS") {
+		ha1 = h(fmt.Sprintf("%v:%v:%v", ha1, params["nonce"], params["cnonce"]))
+	}
+
+	a2 := r.Method + ":" + params["uri"]
+	if params["qop"] == "auth-int" {
+		body, _ := ioutil.ReadAll(r.Body)
+		a2 += ":" + h(string(body))
+	}
+
+	var expected string
+	if params["qop"] == "" {
+		expected = h(fmt.Sprintf("%v:%v:%v", ha1, params["nonce"], h(a2)))
+	} else {
+		expected = h(fmt.Sprintf("%v:%v:%v:%v:%v:%v", ha1, params["nonce"], params["nc"], params["cnonce"],
+			params["qop"], h(a2)))
+	}
+	if params["response"] != expected {
+		return fmt.Errorf("wrong response %v, expected %v", params["response"], expected)
+	}
+	if params["opaque"] != "abc" {
+		return fmt.Errorf("wrong opaque %v", params["opaque"])
+	}
+
+	if params["qop"] != "" {
+		if o.ncs == nil {
+			o.ncs = make(map[string]bool)
+		}
+		nc := params["nonce"] + ":" + params["nc"]
+		if o.ncs[nc] {
+			return fmt.Errorf("nonce count %v used twice", params["nc"])
+		}
+		o.ncs[nc] = true
+	}
+	return
+}
+
+func TestDigestAuth(t *testing.T) {
+	tests := []struct {
+		name           string
+		server         *digestServer
+		method         string
+		body           string
+		expectedStatus int
+		//expected requests including challenges
+		expectedRequests int
+	}{
+		{name: "MD5", server: &digestServer{algorithm: "MD5", qop: "auth"},
+			expectedStatus: http.StatusOK, expectedRequests: 2},
+		{name: "default algorithm", server: &digestServer{qop: "auth"},
+			expectedStatus: http.StatusOK, expectedRequests: 2},
+		{name: "MD5-sess", server: &digestServer{algorithm: "MD5-sess", qop: "auth"},
+			expectedStatus: http.StatusOK, expectedRequests: 2},
+		{name: "SHA-256", server: &digestServer{algorithm: "SHA-256", qop: "auth"},
+			expectedStatus: http.StatusOK, expectedRequests: 2},
+		{name: "SHA-256-sess", server: &digestServer{algorithm: "SHA-256-sess", qop: "auth"},
+			expectedStatus: http.StatusOK, expectedRequests: 2},
+		{name: "SHA-512-256", server: &digestServer{algorithm: "SHA-512-256", qop: "auth"},
+			expectedStatus: http.StatusOK, expectedRequests: 2},
+		{name: "lower case algorithm", server: &digestServer{algorithm: "sha-256", qop: "auth"},
+			expectedStatus: http.StatusOK, expectedRequests: 2},
+		{name: "qop auth-int", server: &digestServer{algorithm: "SHA-256", qop: "auth-int"},
+			method: http.MethodPost, body: `{"name": "eye"}`, expectedStatus: http.StatusOK, expectedRequests: 2},
+		{name: "qop auth preferred", server: &digestServer{algorithm: "SHA-256", qop: "auth-int, auth"},
+			method: http.MethodPost, body: `{"name": "eye"}`, expectedStatus: http.StatusOK, expectedRequests: 2},
+		{name: "without qop", server: &digestServer{algorithm: "MD5"},
+			expectedStatus: http.StatusOK, expectedRequests: 2},
+		{name: "userhash", server: &digestServer{algorithm: "SHA-256", qop: "auth", userhash: true},
+			expectedStatus: http.StatusOK, expectedRequests: 2},
+		{name: "username*", server: &digestServer{algorithm: "SHA-256", qop: "auth", username: "Jäsøn Doe"},
+			expectedStatus: http.StatusOK, expectedRequests: 2},
+		{name: "strongest of multiple challenges", server: &digestServer{qop: "auth", challenges: []string{
+			`Basic realm="eye"`,
+			`Digest realm="eye", nonce="@@NONCE@@", opaque="abc", algorithm=MD5, qop="auth"`,
+			`Digest realm="eye", nonce="@@NONCE@@", opaque="abc", algorithm=SHA-512-256, qop="auth", ` +
+				`Digest realm="eye", nonce="@@NONCE@@", opaque="abc", algorithm=SHA-256, qop="auth"`,
+			`Digest realm="eye", nonce="@@NONCE@@", opaque="abc", algorithm=UNKNOWN, qop="auth"`}},
+			expectedStatus: http.StatusOK, expectedRequests: 2},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			test.server.realm = "eye"
+			password := "secret"
+			if test.server.username == "" {
+				test.server.username = "admin"
+			}
+			if test.server.password == "" {
+				test.server.password = password
+			}
+			server := httptest.NewServer(test.server)
+			defer server.Close()
+
+			method := test.method
+			if method == "" {
+				method = http.MethodGet
+			}
+			dr := NewRequest(test.server.username, password, method, server.URL+"/dir/index.html?x=1", test.body)
+			resp, err := dr.Execute(NewClient(false, 5*time.Second))
+			if err != nil {
+				t.Fatal(err)
+			}
+			data, _ := ioutil.ReadAll(resp.Body)
+			resp.Body.Close()
+
+			if resp.StatusCode != test.expectedStatus {
+				t.Errorf("status %v, expected %v: %s", resp.StatusCode, test.expectedStatus, data)
+			}
+			if test.server.requests != test.expectedRequests {
+				t.Errorf("%v requests, expected %v", test.server.requests, test.expectedRequests)
+			}
+		})
+	}
+}
+
+func TestDigestAuthWrongPassword(t *testing.T) {
+	server := &digestServer{realm: "eye", username: "admin", password: "secret", algorithm: "SHA-256", qop: "auth"}
+	httpServer := httptest.NewServer(server)
+	defer httpServer.Close()
+
+	client := NewClient(false, 5*time.Second)
+	dr := NewRequest("admin", "wrong", http.MethodGet, httpServer.URL+"/status", "")
+	for i := 1; i <= 3; i++ {
+		resp, err := dr.Execute(client)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusUnauthorized {
+			t.Fatalf("status %v of request %v, expected %v", resp.StatusCode, i, http.StatusUnauthorized)
+		}
+		//the challenge and the rejected authorization, the fresh challenge of the rejection is not followed
+		if server.requests != 2*i || len(server.rejected) != i {
+			t.Fatalf("%v requests with %v rejections after %v executions", server.requests, len(server.rejected), i)
+		}
+	}
+}
+
+func TestOAuth2TokenLifetime(t *testing.T) {
+	for expiresIn, expected := range map[time.Duration]time.Duration{
+		time.Hour:        time.Hour - 30*time.Second,
+		300 * time.Second: 270 * time.Second,
+		30 * time.Second:  27 * time.Second,
+		10 * time.Second:  9 * time.Second,
+	} {
+		if lifetime := tokenLifetime(expiresIn); lifetime != expected {
+			t.Errorf("lifetime %v of %v, expected %v", lifetime, expiresIn, expected)
+		}
+	}
+}
+
+func TestOAuth2ChallengeKeepsRefreshedToken(t *testing.T) {
+	auth := &OAuth2ClientCredentials{token: "refreshed", expiry: time.Now().Add(time.Hour)}
+	rejected := func(token string) *http.Response {
+		req, _ := http.NewRequest(http.MethodGet, "http://localhost/status", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		return &http.Response{StatusCode: http.StatusUnauthorized, Request: req}
+	}
+
+	if retry, err := auth.Challenge(nil, rejected("revoked")); err != nil || !retry || auth.token != "refreshed" {
+		t.Fatalf("retry %v, error %v, token '%v' after the rejection of an old token", retry, err, auth.token)
+	}
+	if retry, err := auth.Challenge(nil, rejected("refreshed")); err != nil || !retry || auth.token != "" {
+		t.Fatalf("retry %v, error %v, token '%v' after the rejection of the cached token", retry, err, auth.token)
+	}
+}
+
+func TestNonceCacheLimit(t *testing.T) {
+	cache := &nonceCache{items: make(map[string]*digestNonce), maxItems: 3}
+	for _, key := range []string{"a", "b", "c"} {
+		cache.put(key, &wwwAuthenticate{Nonce: key})
+	}
+	cache.get("a")
+	cache.put("d", &wwwAuthenticate{Nonce: "d"})
+
+	if len(cache.items) != 3 || cache.get("b") != nil || cache.get("a") == nil || cache.get("d") == nil {
+		t.Errorf("the least recently used nonce is not evicted: %v", cache.items)
+	}
+}
+
+func TestDigestAuthStaleNonce(t *testing.T) {
+	server := &digestServer{realm: "eye", username: "admin", password: "secret", algorithm: "SHA-256",
+		qop: "auth", staleAfter: 2}
+	httpServer := httptest.NewServer(server)
+	defer httpServer.Close()
+
+	client := NewClient(false, 5*time.Second)
+	dr := NewRequest("admin", "secret", http.MethodGet, httpServer.URL+"/status", "")
+	for i := 0; i < 5; i++ {
+		resp, err := dr.Execute(client)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("status %v of request %v", resp.StatusCode, i)
+		}
+	}
+
+	//5 requests, the initial challenge and a stale challenge for each further nonce
+	if server.requests != 8 || server.nonces != 3 {
+		t.Errorf("%v requests with %v nonces, expected 8 requests with 3 nonces", server.requests, server.nonces)
+	}
+}
+
+func TestDigestResponseRfc7616(t *testing.T) {
+	dr := NewRequest("Mufasa", "Circle of Life", http.MethodGet, "http://www.example.org/dir/index.html", "")
+	for algorithm, expected := range map[string]string{
+		"MD5":     "8ca523f5e9506fed4657c9700eebdbec",
+		"SHA-256": "753927fa0e85d155564e2e272a28d1802ca10daf4496794697cf8db5856cb6c1",
+	} {
+		ah := &authorization{Algorithm: algorithm, Realm: "http-auth@example.org", Qop: "auth", Nc: 1,
+			Nonce:  "7ypf/xlj9XXwfDPEoM4URrv/xwf94BcCAzFZH4GiTo0v",
+			Cnonce: "f2/wE4q74E6zIJEtWaHKaf5wv/H5QzzpXusqGemxURZJ", Uri: "/dir/index.html"}
+		if response := ah.computeResponse(&dr); response != expected {
+			t.Errorf("%v response %v, expected %v", algorithm, response, expected)
+		}
+	}
+}
+
+func TestParseChallenges(t *testing.T) {
+	challenges := parseChallenges(`Negotiate abc==, Basic realm="a, \"b\"", Digest realm=eye,nonce="n", ` +
+		`algorithm=SHA-256, stale=TRUE`)
+	if len(challenges) != 3 {
+		t.Fatalf("%v challenges, expected 3", len(challenges))
+	}
+	if challenges[1].Params["realm"] != `a, "b"` {
+		t.Errorf("realm %v", challenges[1].Params["realm"])
+	}
+
+	wa, err := selectWwwAuthenticate([]string{`Basic realm="a"`, `Digest realm=eye,nonce="n", algorithm=SHA-256, stale=TRUE`})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if wa.Realm != "eye" || wa.Nonce != "n" || wa.Algorithm != "SHA-256" || !wa.Stale {
+		t.Errorf("unexpected challenge %+v", wa)
+	}
+
+	if _, err = selectWwwAuthenticate([]string{`Basic realm="a"`}); err == nil {
+		t.Errorf("error expected for missing digest challenge")
+	}
+}
+
+func TestDigestAuthConcurrent(t *testing.T) {
+	server := &digestServer{realm: "eye", username: "admin", password: "secret", algorithm: "SHA-256",
+		qop: "auth"}
+	httpServer := httptest.NewServer(server)
+	defer httpServer.Close()
+
+	client := NewClient(false, 5*time.Second)
+	dr := NewRequest("admin", "secret", http.MethodGet, httpServer.URL+"/status", "")
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 200)
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 10; j++ {
+				resp, err := dr.Execute(client)
+				if err != nil {
+					errs <- err
+					return
+				}
+				data, _ := ioutil.ReadAll(resp.Body)
+				resp.Body.Close()
+				if resp.StatusCode != http.StatusOK {
+					errs <- fmt.Errorf("status %v: %s", resp.StatusCode, data)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		t.Error(err)
+	}
+}
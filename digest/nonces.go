@@ -0,0 +1,73 @@
+package digest
+
+import (
+	"net/url"
+	"sync"
+	"sync/atomic"
+)
+
+//digestNonce is a server nonce with its nonce count, shared by all requests to the same host
+type digestNonce struct {
+	wa *wwwAuthenticate
+	nc int64
+	//last use, the least recently used nonce is evicted from the full cache
+	used int64
+}
+
+func (o *digestNonce) nextNc() int {
+	return int(atomic.AddInt64(&o.nc, 1))
+}
+
+//maximal count of cached nonces, nonces of hosts not used anymore are evicted
+const maxNonces = 256
+
+//nonceCache holds the current nonce per host and user
+type nonceCache struct {
+	items    map[string]*digestNonce
+	maxItems int
+	used     int64
+	lock     sync.RWMutex
+}
+
+var nonces = &nonceCache{items: make(map[string]*digestNonce), maxItems: maxNonces}
+
+func nonceKey(u *url.URL, username string) string {
+	return u.Scheme + "://" + u.Host + "|" + username
+}
+
+func (o *nonceCache) get(key string) (ret *digestNonce) {
+	o.lock.RLock()
+	if ret = o.items[key]; ret != nil {
+		atomic.StoreInt64(&ret.used, atomic.AddInt64(&o.used, 1))
+	}
+	o.lock.RUnlock()
+	return
+}
+
+//put keeps the nonce count, if the nonce is already known, e.g. from a concurrent challenge
+func (o *nonceCache) put(key string, wa *wwwAuthenticate) {
+	o.lock.Lock()
+	if current, ok := o.items[key]; !ok || current.wa.Nonce != wa.Nonce {
+		if !ok && len(o.items) >= o.maxItems {
+			delete(o.items, o.leastRecentlyUsed())
+		}
+		o.items[key] = &digestNonce{wa: wa, used: atomic.AddInt64(&o.used, 1)}
+	}
+	o.lock.Unlock()
+}
+
+func (o *nonceCache) leastRecentlyUsed() (ret string) {
+	var used int64
+	for key, item := range o.items {
+		if itemUsed := atomic.LoadInt64(&item.used); ret == "" || itemUsed < used {
+			ret, used = key, itemUsed
+		}
+	}
+	return
+}
+
+func (o *nonceCache) remove(key string) {
+	o.lock.Lock()
+	delete(o.items, key)
+	o.lock.Unlock()
+}
@@ -1,7 +1,7 @@
 package digest
 
 import (
-	"regexp"
+	"errors"
 	"strings"
 )
 
@@ -17,63 +17,155 @@ type wwwAuthenticate struct {
 	Userhash  bool   // quoted
 }
 
-func newWwwAuthenticate(s string) *wwwAuthenticate {
+//algorithmStrength of the supported algorithms, the strongest offered by the server is used
+var algorithmStrength = map[string]int{
+	"MD5":         1,
+	"SHA-256":     2,
+	"SHA-512-256": 3,
+}
 
-	var wa = wwwAuthenticate{}
+type challenge struct {
+	Scheme string
+	Params map[string]string
+}
 
-	algorithmRegex := regexp.MustCompile(`algorithm=([^ ,]+)`)
-	algorithmMatch := algorithmRegex.FindStringSubmatch(s)
-	if algorithmMatch != nil {
-		wa.Algorithm = algorithmMatch[1]
+// selectWwwAuthenticate parses all challenges of the WWW-Authenticate headers and selects
+// the digest challenge with the strongest supported algorithm.
+func selectWwwAuthenticate(headers []string) (ret *wwwAuthenticate, err error) {
+	strength := 0
+	for _, header := range headers {
+		for _, item := range parseChallenges(header) {
+			if !strings.EqualFold(item.Scheme, "Digest") {
+				continue
+			}
+			wa := item.toWwwAuthenticate()
+			if current := wa.strength(); current > strength {
+				ret = wa
+				strength = current
+			}
+		}
 	}
-
-	domainRegex := regexp.MustCompile(`domain="(.+?)"`)
-	domainMatch := domainRegex.FindStringSubmatch(s)
-	if domainMatch != nil {
-		wa.Domain = domainMatch[1]
+	if ret == nil {
+		err = errors.New("No digest challenge with a supported algorithm in the WWW-Authenticate headers")
 	}
+	return
+}
+
+func (o *wwwAuthenticate) strength() int {
+	return algorithmStrength[baseAlgorithm(o.Algorithm)]
+}
 
-	nonceRegex := regexp.MustCompile(`nonce="(.+?)"`)
-	nonceMatch := nonceRegex.FindStringSubmatch(s)
-	if nonceMatch != nil {
-		wa.Nonce = nonceMatch[1]
+func (o *challenge) toWwwAuthenticate() *wwwAuthenticate {
+	return &wwwAuthenticate{
+		Algorithm: o.Params["algorithm"],
+		Domain:    o.Params["domain"],
+		Nonce:     o.Params["nonce"],
+		Opaque:    o.Params["opaque"],
+		Qop:       o.Params["qop"],
+		Realm:     o.Params["realm"],
+		Stale:     strings.EqualFold(o.Params["stale"], "true"),
+		Charset:   o.Params["charset"],
+		Userhash:  strings.EqualFold(o.Params["userhash"], "true"),
 	}
+}
 
-	opaqueRegex := regexp.MustCompile(`opaque="(.+?)"`)
-	opaqueMatch := opaqueRegex.FindStringSubmatch(s)
-	if opaqueMatch != nil {
-		wa.Opaque = opaqueMatch[1]
+//baseAlgorithm returns the algorithm without '-sess' suffix, MD5 if not set
+func baseAlgorithm(algorithm string) string {
+	ret := strings.ToUpper(algorithm)
+	ret = strings.TrimSuffix(ret, "-SESS")
+	if ret == "" {
+		ret = "MD5"
 	}
+	return ret
+}
+
+// parseChallenges parses a WWW-Authenticate header value, which may contain several challenges:
+// challenge = scheme [ 1*SP ( token68 / #auth-param ) ], auth-param = token "=" ( token / quoted-string )
+func parseChallenges(s string) (ret []*challenge) {
+	p := &challengeParser{s: s}
+	var current *challenge
+	for {
+		p.skip(" \t,")
+		if p.end() {
+			break
+		}
+		token := p.token()
+		if token == "" {
+			//skip unexpected character
+			p.pos++
+			continue
+		}
+
+		p.skip(" \t")
+		if current == nil || p.peek() != '=' {
+			current = &challenge{Scheme: token, Params: make(map[string]string)}
+			ret = append(ret, current)
+			continue
+		}
 
-	qopRegex := regexp.MustCompile(`qop="(.+?)"`)
-	qopMatch := qopRegex.FindStringSubmatch(s)
-	if qopMatch != nil {
-		wa.Qop = qopMatch[1]
+		p.pos++
+		p.skip(" \t")
+		switch c := p.peek(); {
+		case c == '"':
+			current.Params[strings.ToLower(token)] = p.quoted()
+		case c == '=' || c == ',' || p.end():
+			//padding of a token68, e.g. 'Negotiate abc=='
+			p.skip("=")
+		default:
+			current.Params[strings.ToLower(token)] = p.token()
+		}
 	}
+	return
+}
+
+type challengeParser struct {
+	s   string
+	pos int
+}
+
+func (o *challengeParser) end() bool {
+	return o.pos >= len(o.s)
+}
 
-	realmRegex := regexp.MustCompile(`realm="(.+?)"`)
-	realmMatch := realmRegex.FindStringSubmatch(s)
-	if realmMatch != nil {
-		wa.Realm = realmMatch[1]
+func (o *challengeParser) peek() byte {
+	if o.end() {
+		return 0
 	}
+	return o.s[o.pos]
+}
 
-	staleRegex := regexp.MustCompile(`stale=([^ ,])"`)
-	staleMatch := staleRegex.FindStringSubmatch(s)
-	if staleMatch != nil {
-		wa.Stale = (strings.ToLower(staleMatch[1]) == "true")
+func (o *challengeParser) skip(chars string) {
+	for !o.end() && strings.IndexByte(chars, o.s[o.pos]) >= 0 {
+		o.pos++
 	}
+}
 
-	charsetRegex := regexp.MustCompile(`charset="(.+?)"`)
-	charsetMatch := charsetRegex.FindStringSubmatch(s)
-	if charsetMatch != nil {
-		wa.Charset = charsetMatch[1]
+func (o *challengeParser) token() string {
+	start := o.pos
+	for !o.end() && isTokenChar(o.s[o.pos]) {
+		o.pos++
 	}
+	return o.s[start:o.pos]
+}
 
-	userhashRegex := regexp.MustCompile(`userhash=([^ ,])"`)
-	userhashMatch := userhashRegex.FindStringSubmatch(s)
-	if userhashMatch != nil {
-		wa.Userhash = (strings.ToLower(userhashMatch[1]) == "true")
+func (o *challengeParser) quoted() string {
+	var buffer []byte
+	o.pos++
+	for !o.end() {
+		c := o.s[o.pos]
+		o.pos++
+		if c == '\\' && !o.end() {
+			buffer = append(buffer, o.s[o.pos])
+			o.pos++
+		} else if c == '"' {
+			break
+		} else {
+			buffer = append(buffer, c)
+		}
 	}
+	return string(buffer)
+}
 
-	return &wa
+func isTokenChar(c byte) bool {
+	return c > 32 && c < 127 && strings.IndexByte("()<>@,;:\\\"/[]?={} \t", c) < 0
 }
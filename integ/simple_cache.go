@@ -15,40 +15,49 @@ func NewCache() *SimpleCache {
 	return &SimpleCache{MaxSize: 1000, data: make(map[string]interface{}), lock: sync.Mutex{}}
 }
 
-func (o SimpleCache) Clear() {
+func (o *SimpleCache) Clear() {
 	o.lock.Lock()
 	o.data = make(map[string]interface{})
 	o.lock.Unlock()
 	return
 }
 
-func (o SimpleCache) Get(key string, builder func() interface{}) (value interface{}, ok bool) {
+func (o *SimpleCache) Get(key string, builder func() interface{}) (value interface{}, ok bool) {
 	o.lock.Lock()
 	value, ok = o.data[key]
 	o.lock.Unlock()
 	return
 }
 
-func (o SimpleCache) GetOrBuild(key string, builder func() (interface{}, error)) (value interface{}, err error) {
+//GetOrBuild builds the value outside of the lock, because builders may use the cache as well
+func (o *SimpleCache) GetOrBuild(key string, builder func() (interface{}, error)) (value interface{}, err error) {
 	o.lock.Lock()
 	value, ok := o.data[key]
-	if !ok {
-		value, err = builder()
-		if err == nil {
+	o.lock.Unlock()
+	if ok {
+		return
+	}
+
+	if value, err = builder(); err == nil {
+		o.lock.Lock()
+		//keep the value of a concurrent build
+		if current, ok := o.data[key]; ok {
+			value = current
+		} else {
 			o.put(key, value)
 		}
+		o.lock.Unlock()
 	}
-	o.lock.Unlock()
 	return
 }
 
-func (o SimpleCache) Put(key string, value interface{}) {
+func (o *SimpleCache) Put(key string, value interface{}) {
 	o.lock.Lock()
 	o.put(key, value)
 	o.lock.Unlock()
 }
 
-func (o SimpleCache) put(key string, value interface{}) {
+func (o *SimpleCache) put(key string, value interface{}) {
 	//reset cache
 	if len(o.data) >= o.MaxSize {
 		o.data = make(map[string]interface{})
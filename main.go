@@ -198,12 +198,24 @@ func defineRoutes(engine *gin.Engine, controller *core.Eye, config *core.Config)
 		servicesGroup.GET("/all/compare/:check", func(c *gin.Context) {
 			response(controller.CompareAll(servicesCompare(c)), c)
 		})
+
+		servicesGroup.GET("/running/diff", func(c *gin.Context) {
+			diffResponse(controller.CompareRunningDiff(servicesCompare(c)))(c)
+		})
+
+		servicesGroup.GET("/all/diff", func(c *gin.Context) {
+			diffResponse(controller.CompareAllDiff(servicesCompare(c)))(c)
+		})
 	}
 	checkGroup := engine.Group("/check")
 	{
 		checkGroup.GET("/:check", func(c *gin.Context) {
 			response(controller.Check(c.Param("check")), c)
 		})
+
+		checkGroup.GET("/:check/diff", func(c *gin.Context) {
+			diffResponse(controller.CheckDiff(c.Param("check")))(c)
+		})
 	}
 	exportGroup := engine.Group("/export")
 	{
@@ -240,6 +252,11 @@ func defineRoutes(engine *gin.Engine, controller *core.Eye, config *core.Config)
 			response(err, c)
 		})
 
+		adminGroup.GET("/stats", func(c *gin.Context) {
+			c.Header("Content-Type", "application/json; charset=UTF-8")
+			c.IndentedJSON(http.StatusOK, controller.Stats())
+		})
+
 		adminGroup.GET("/config", func(c *gin.Context) {
 			c.Header("Content-Type", "application/json; charset=UTF-8")
 			c.IndentedJSON(http.StatusOK, currentConfig)
@@ -256,8 +273,34 @@ func servicesQuery(c *gin.Context) ([]string, *core.ValidationRequest) {
 }
 
 func servicesCompare(c *gin.Context) ([]string, *core.ValidationRequest) {
-	return strings.Split(c.DefaultQuery("services", ""), ","),
-		validationReq(c)
+	req := validationReq(c)
+	req.JoinKeys = queryList("join", c)
+	req.EqualFields = queryList("equal", c)
+	req.Tolerances = queryMap("tolerance", c)
+	return strings.Split(c.DefaultQuery("services", ""), ","), req
+}
+
+func queryList(key string, c *gin.Context) (ret []string) {
+	if value := c.Query(key); value != "" {
+		ret = strings.Split(value, ",")
+	}
+	return ret
+}
+
+//queryMap parses 'key1:value1,key2:value2'
+func queryMap(key string, c *gin.Context) (ret map[string]string) {
+	for _, item := range queryList(key, c) {
+		if ret == nil {
+			ret = make(map[string]string)
+		}
+		keyValue := strings.SplitN(item, ":", 2)
+		if len(keyValue) == 2 {
+			ret[keyValue[0]] = keyValue[1]
+		} else {
+			ret[keyValue[0]] = ""
+		}
+	}
+	return ret
 }
 
 func queryInt(key string, c *gin.Context) (ret int) {
@@ -284,21 +327,74 @@ func serviceQuery(c *gin.Context) (string, *core.ValidationRequest) {
 
 func validationReq(c *gin.Context) *core.ValidationRequest {
 	return &core.ValidationRequest{
-		Query:    c.DefaultQuery("query", ""),
-		RegExpr:  c.DefaultQuery("expr", ""),
-		EvalExpr: c.Query("eval"), }
+		Query:       c.DefaultQuery("query", ""),
+		RegExpr:     c.DefaultQuery("expr", ""),
+		JsonPath:    c.DefaultQuery("json", ""),
+		EvalExpr:    c.Query("eval"),
+		AggrExpr:    c.DefaultQuery("aggr", ""),
+		Limit:       queryInt("limit", c),
+		Args:        c.QueryArray("arg"),
+		Listing:     fileListing(c),
+		Kind:        c.DefaultQuery("kind", ""), }
+}
+
+//fileListing parses 'glob', 'depth', 'exclude', 'followSymlinks' and 'maxFiles' of fs checks, nil if none is given
+func fileListing(c *gin.Context) (ret *core.FileListing) {
+	for _, key := range []string{"glob", "depth", "exclude", "followSymlinks", "maxFiles"} {
+		if _, ok := c.GetQuery(key); ok {
+			ret = &core.FileListing{
+				Glob:           c.Query("glob"),
+				MaxDepth:       queryInt("depth", c),
+				Exclude:        queryList("exclude", c),
+				FollowSymlinks: queryFlag("followSymlinks", c),
+				MaxFiles:       queryInt("maxFiles", c)}
+			break
+		}
+	}
+	return
 }
 
 func response(err error, c *gin.Context) {
 	c.Header("Content-Type", "application/json; charset=UTF-8")
 	if err == nil {
 		c.String(http.StatusOK, "{ \"ok\": true }")
+	} else if diffErr, ok := err.(*core.DiffError); ok {
+		jsonDesc, _ := json.Marshal(err.Error())
+		jsonDiff, _ := json.Marshal(diffErr.Report)
+		c.String(http.StatusConflict, fmt.Sprintf("{ \"ok\": false, \"desc:\": %s, \"diff\": %s }", jsonDesc, jsonDiff))
 	} else {
 		jsonDesc, _ := json.Marshal(err.Error())
 		c.String(http.StatusConflict, fmt.Sprintf("{ \"ok\": false, \"desc:\": %s }", jsonDesc))
 	}
 }
 
+//diffResponse writes the diff report as json or, with 'format=csv|html', as a downloadable report
+func diffResponse(report *core.DiffReport, err error) func(c *gin.Context) {
+	return func(c *gin.Context) {
+		if err != nil {
+			response(err, c)
+			return
+		}
+		fileName := strings.Replace(report.Check, "/", "_", -1)
+		switch format := c.DefaultQuery("format", core.DiffFormatJson); format {
+		case core.DiffFormatCsv:
+			c.Header("Content-Type", "text/csv; charset=UTF-8")
+			c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=\"diff_%v.csv\"", fileName))
+			err = report.WriteCsv(c.Writer)
+		case core.DiffFormatHtml:
+			c.Header("Content-Type", "text/html; charset=UTF-8")
+			c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=\"diff_%v.html\"", fileName))
+			err = report.WriteHtml(c.Writer)
+		default:
+			c.Header("Content-Type", "application/json; charset=UTF-8")
+			c.IndentedJSON(http.StatusOK, report)
+		}
+		if err != nil {
+			l.Err("Writing of the diff report failed because of %v", err)
+		}
+	}
+}
+
 type LocalFs struct {
 }
 